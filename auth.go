@@ -0,0 +1,181 @@
+package graphdb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/mattmeyers/graphdb/bolt"
+	"github.com/mattmeyers/graphdb/packstream"
+)
+
+// AuthToken holds the credentials a connection authenticates with. Tokens
+// are usually created with one of the constructors such as BasicAuth.
+type AuthToken struct {
+	Scheme      string
+	Principal   string
+	Credentials string
+	Realm       string
+	Parameters  map[string]interface{}
+}
+
+// NoAuth returns a token for servers with authentication disabled.
+func NoAuth() AuthToken {
+	return AuthToken{Scheme: "none"}
+}
+
+// BasicAuth returns a token authenticating with a username and password. The
+// realm may be empty to use the server's default.
+func BasicAuth(username, password, realm string) AuthToken {
+	return AuthToken{Scheme: "basic", Principal: username, Credentials: password, Realm: realm}
+}
+
+// BearerAuth returns a token authenticating with a bearer token issued by an
+// identity provider, e.g. an OIDC access token.
+func BearerAuth(token string) AuthToken {
+	return AuthToken{Scheme: "bearer", Credentials: token}
+}
+
+// KerberosAuth returns a token authenticating with a base64 encoded Kerberos
+// ticket. The server requires an empty principal, which is always sent.
+func KerberosAuth(ticket string) AuthToken {
+	return AuthToken{Scheme: "kerberos", Credentials: ticket}
+}
+
+// CustomAuth returns a token for a scheme implemented by a server plugin.
+func CustomAuth(scheme, principal, credentials, realm string, parameters map[string]interface{}) AuthToken {
+	return AuthToken{
+		Scheme:      scheme,
+		Principal:   principal,
+		Credentials: credentials,
+		Realm:       realm,
+		Parameters:  parameters,
+	}
+}
+
+// dictionary returns the token as sent in HELLO or LOGON. Empty fields are
+// left out, except for the principal of the kerberos scheme.
+func (t AuthToken) dictionary() packstream.Dictionary {
+	d := packstream.Dictionary{"scheme": t.Scheme}
+	if t.Principal != "" || t.Scheme == "kerberos" {
+		d["principal"] = t.Principal
+	}
+	if t.Credentials != "" {
+		d["credentials"] = t.Credentials
+	}
+	if t.Realm != "" {
+		d["realm"] = t.Realm
+	}
+	if len(t.Parameters) > 0 {
+		d["parameters"] = packstream.Dictionary(t.Parameters)
+	}
+
+	return d
+}
+
+func (t AuthToken) equal(o AuthToken) bool {
+	return reflect.DeepEqual(t, o)
+}
+
+// AuthTokenManager provides the auth token of new connections and allows
+// rotating it. Pooled connections authenticated with an outdated token are
+// re-authenticated with LOGOFF and LOGON on Bolt 5.1 and later, and replaced
+// on earlier versions. Implementations must be safe for concurrent use.
+type AuthTokenManager interface {
+	// GetAuthToken returns the token connections should use.
+	GetAuthToken(ctx context.Context) (AuthToken, error)
+
+	// HandleSecurityError is called when work authenticated with token
+	// failed with a security error. It returns true if the manager has
+	// provided a new token, so the work can be retried.
+	HandleSecurityError(ctx context.Context, token AuthToken, err error) bool
+}
+
+// StaticAuthTokenManager returns a manager that always provides token.
+func StaticAuthTokenManager(token AuthToken) AuthTokenManager {
+	return staticAuthTokenManager{token}
+}
+
+type staticAuthTokenManager struct {
+	token AuthToken
+}
+
+func (m staticAuthTokenManager) GetAuthToken(ctx context.Context) (AuthToken, error) {
+	return m.token, nil
+}
+
+func (m staticAuthTokenManager) HandleSecurityError(ctx context.Context, token AuthToken, err error) bool {
+	return false
+}
+
+// ExpiringAuthTokenManager returns a manager for tokens that expire, such as
+// bearer tokens. It calls provider for a new token once the current one has
+// expired or the server has reported it expired. A zero expiry time means
+// the token does not expire.
+func ExpiringAuthTokenManager(provider func(ctx context.Context) (AuthToken, time.Time, error)) AuthTokenManager {
+	return &expiringAuthTokenManager{provider: provider, now: time.Now}
+}
+
+type expiringAuthTokenManager struct {
+	provider func(ctx context.Context) (AuthToken, time.Time, error)
+
+	// now returns the current time. It is replaced in tests.
+	now func() time.Time
+
+	mu      sync.Mutex
+	token   *AuthToken
+	expires time.Time
+}
+
+func (m *expiringAuthTokenManager) GetAuthToken(ctx context.Context) (AuthToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.token != nil && (m.expires.IsZero() || m.now().Before(m.expires)) {
+		return *m.token, nil
+	}
+
+	token, expires, err := m.provider(ctx)
+	if err != nil {
+		return AuthToken{}, err
+	}
+	m.token, m.expires = &token, expires
+
+	return token, nil
+}
+
+func (m *expiringAuthTokenManager) HandleSecurityError(ctx context.Context, token AuthToken, err error) bool {
+	if !errors.Is(err, &bolt.Neo4jError{Code: "Neo.ClientError.Security.TokenExpired"}) {
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Another session may have rotated the token already.
+	if m.token != nil && m.token.equal(token) {
+		m.token = nil
+	}
+
+	return true
+}
+
+// authError is a failure to authenticate a connection with token. Security
+// errors among them are passed to the AuthTokenManager like those of
+// queries, which lets managed transactions retry with a new token.
+type authError struct {
+	token AuthToken
+	err   error
+}
+
+func (e *authError) Error() string { return e.err.Error() }
+func (e *authError) Unwrap() error { return e.err }
+
+// isSecurityError reports whether err is a security error of the server,
+// such as an expired token.
+func isSecurityError(err error) bool {
+	var ne *bolt.Neo4jError
+	return errors.As(err, &ne) && ne.Category() == "Security"
+}
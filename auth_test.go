@@ -0,0 +1,360 @@
+package graphdb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattmeyers/graphdb/bolt"
+	"github.com/mattmeyers/graphdb/bolt/bolttest"
+	"github.com/mattmeyers/graphdb/packstream"
+)
+
+func TestAuthToken_dictionary(t *testing.T) {
+	tests := []struct {
+		name  string
+		token AuthToken
+		want  packstream.Dictionary
+	}{
+		{
+			name:  "none",
+			token: NoAuth(),
+			want:  packstream.Dictionary{"scheme": "none"},
+		},
+		{
+			name:  "basic",
+			token: BasicAuth("neo4j", "secret", ""),
+			want:  packstream.Dictionary{"scheme": "basic", "principal": "neo4j", "credentials": "secret"},
+		},
+		{
+			name:  "basic with realm",
+			token: BasicAuth("neo4j", "secret", "native"),
+			want:  packstream.Dictionary{"scheme": "basic", "principal": "neo4j", "credentials": "secret", "realm": "native"},
+		},
+		{
+			name:  "bearer",
+			token: BearerAuth("eyJhbGciOi"),
+			want:  packstream.Dictionary{"scheme": "bearer", "credentials": "eyJhbGciOi"},
+		},
+		{
+			name:  "kerberos",
+			token: KerberosAuth("dGlja2V0"),
+			want:  packstream.Dictionary{"scheme": "kerberos", "principal": "", "credentials": "dGlja2V0"},
+		},
+		{
+			name:  "custom",
+			token: CustomAuth("plugin", "alice", "pw", "ldap", map[string]interface{}{"otp": "123456"}),
+			want: packstream.Dictionary{
+				"scheme":      "plugin",
+				"principal":   "alice",
+				"credentials": "pw",
+				"realm":       "ldap",
+				"parameters":  packstream.Dictionary{"otp": "123456"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.token.dictionary(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AuthToken.dictionary() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpiringAuthTokenManager(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	calls := 0
+	m := ExpiringAuthTokenManager(func(context.Context) (AuthToken, time.Time, error) {
+		calls++
+		return BearerAuth(fmt.Sprintf("token%d", calls)), now.Add(time.Hour), nil
+	}).(*expiringAuthTokenManager)
+	m.now = func() time.Time { return now }
+
+	get := func(want string) {
+		t.Helper()
+		token, err := m.GetAuthToken(ctx)
+		if err != nil {
+			t.Fatalf("GetAuthToken() error = %v", err)
+		}
+		if token.Credentials != want {
+			t.Errorf("GetAuthToken() = %v, want %v", token.Credentials, want)
+		}
+	}
+
+	get("token1")
+	get("token1")
+
+	now = now.Add(time.Hour)
+	get("token2")
+
+	if m.HandleSecurityError(ctx, BearerAuth("token2"), &bolt.Neo4jError{Code: "Neo.ClientError.Security.Unauthorized"}) {
+		t.Errorf("HandleSecurityError() = true for Unauthorized")
+	}
+	get("token2")
+
+	// An expired token reported for an outdated token keeps the current one.
+	if !m.HandleSecurityError(ctx, BearerAuth("token1"), &bolt.Neo4jError{Code: "Neo.ClientError.Security.TokenExpired"}) {
+		t.Errorf("HandleSecurityError() = false for TokenExpired")
+	}
+	get("token2")
+
+	if !m.HandleSecurityError(ctx, BearerAuth("token2"), &bolt.Neo4jError{Code: "Neo.ClientError.Security.TokenExpired"}) {
+		t.Errorf("HandleSecurityError() = false for TokenExpired")
+	}
+	get("token3")
+}
+
+// rotatingAuthManager provides a token that tests replace at will.
+type rotatingAuthManager struct {
+	mu    sync.Mutex
+	token AuthToken
+}
+
+func (m *rotatingAuthManager) GetAuthToken(ctx context.Context) (AuthToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.token, nil
+}
+
+func (m *rotatingAuthManager) HandleSecurityError(ctx context.Context, token AuthToken, err error) bool {
+	return false
+}
+
+func (m *rotatingAuthManager) set(token AuthToken) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.token = token
+}
+
+func TestDriver_authRotation(t *testing.T) {
+	tests := []struct {
+		name        string
+		version     bolt.Version
+		wantReqs    []string
+		wantCreated int64
+	}{
+		{
+			name:        "re-authenticates from 5.1",
+			version:     bolt.Version{Major: 5, Minor: 1},
+			wantReqs:    []string{"Hello", "Logon", "Run", "Discard", "Logoff", "Logon", "Run", "Discard"},
+			wantCreated: 1,
+		},
+		{
+			name:        "reconnects before 5.1",
+			version:     bolt.Version{Major: 5, Minor: 0},
+			wantReqs:    []string{"Hello", "Run", "Discard", "Hello", "Run", "Discard"},
+			wantCreated: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recorder{}
+			s := bolttest.NewUnstartedServer(rec.handle)
+			s.Versions = []bolt.Version{tt.version}
+			s.Start()
+			t.Cleanup(s.Close)
+
+			m := &rotatingAuthManager{token: BasicAuth("neo4j", "old", "")}
+			d, err := NewDriver("bolt://"+s.Addr(), func(c *Config) { c.AuthManager = m })
+			if err != nil {
+				t.Fatalf("NewDriver() error = %v", err)
+			}
+			defer d.Close()
+
+			if err := run(t, d, SessionConfig{}, "RETURN 1"); err != nil {
+				t.Fatalf("run error = %v", err)
+			}
+			m.set(BasicAuth("neo4j", "new", ""))
+			if err := run(t, d, SessionConfig{}, "RETURN 1"); err != nil {
+				t.Fatalf("run error = %v", err)
+			}
+
+			rec.mu.Lock()
+			defer rec.mu.Unlock()
+
+			// Closing connections sends GOODBYE, which is not passed to
+			// handlers.
+			if got := requestNames(rec.reqs); !reflect.DeepEqual(got, tt.wantReqs) {
+				t.Errorf("requests = %v, want %v", got, tt.wantReqs)
+			}
+
+			var last packstream.Dictionary
+			for _, req := range rec.reqs {
+				switch req := req.(type) {
+				case bolt.Hello:
+					last = req.Extra
+				case bolt.Logon:
+					last = req.Auth
+				}
+			}
+			if last["credentials"] != "new" {
+				t.Errorf("last credentials = %v, want new", last["credentials"])
+			}
+
+			if got := d.PoolMetrics()[d.addr].Created; got != tt.wantCreated {
+				t.Errorf("PoolMetrics() Created = %d, want %d", got, tt.wantCreated)
+			}
+		})
+	}
+}
+
+func TestSession_ExecuteWrite_tokenExpired(t *testing.T) {
+	ctx := context.Background()
+	s := newFlakyServer(t, "Run", "Neo.ClientError.Security.TokenExpired", 1)
+
+	tokens := 0
+	m := ExpiringAuthTokenManager(func(context.Context) (AuthToken, time.Time, error) {
+		tokens++
+		return BearerAuth(fmt.Sprintf("token%d", tokens)), time.Time{}, nil
+	})
+
+	d, err := NewDriver("bolt://"+s.Addr(), func(c *Config) { c.AuthManager = m })
+	if err != nil {
+		t.Fatalf("NewDriver() error = %v", err)
+	}
+	defer d.Close()
+	d.retry.sleep = func(context.Context, time.Duration) error { return nil }
+
+	sess := d.NewSession(SessionConfig{})
+	defer sess.Close(ctx)
+
+	_, err = sess.ExecuteWrite(ctx, func(tx *Tx) (interface{}, error) {
+		res, err := tx.Run(ctx, "CREATE (n)", nil)
+		if err != nil {
+			return nil, err
+		}
+		return res.Consume(ctx)
+	})
+	if err != nil {
+		t.Fatalf("Session.ExecuteWrite() error = %v", err)
+	}
+
+	if tokens != 2 {
+		t.Errorf("tokens provided = %d, want 2", tokens)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attempts != 2 {
+		t.Errorf("attempts = %d, want 2", s.attempts)
+	}
+}
+
+// notifiedAuthManager records the tokens of the security errors passed to
+// the manager it wraps.
+type notifiedAuthManager struct {
+	AuthTokenManager
+
+	mu       sync.Mutex
+	notified []interface{}
+}
+
+func (m *notifiedAuthManager) HandleSecurityError(ctx context.Context, token AuthToken, err error) bool {
+	m.mu.Lock()
+	m.notified = append(m.notified, token.Credentials)
+	m.mu.Unlock()
+
+	return m.AuthTokenManager.HandleSecurityError(ctx, token, err)
+}
+
+func TestSession_ExecuteWrite_logonTokenExpired(t *testing.T) {
+	tests := []struct {
+		name string
+		// idle runs a query with token1 first, leaving an idle connection
+		// that is re-authenticated with token2.
+		idle         bool
+		rejected     string
+		wantNotified []interface{}
+		wantLogons   []interface{}
+	}{
+		{
+			name:         "new connection",
+			rejected:     "token1",
+			wantNotified: []interface{}{"token1"},
+			wantLogons:   []interface{}{"token1", "token2"},
+		},
+		{
+			name:         "idle connection",
+			idle:         true,
+			rejected:     "token2",
+			wantNotified: []interface{}{"token2"},
+			wantLogons:   []interface{}{"token1", "token2", "token3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			expired := &bolt.Neo4jError{Code: "Neo.ClientError.Security.TokenExpired"}
+
+			var mu sync.Mutex
+			var logons []interface{}
+			s := bolttest.NewUnstartedServer(func(req bolt.Message) []bolt.Message {
+				if req, ok := req.(bolt.Logon); ok {
+					mu.Lock()
+					logons = append(logons, req.Auth["credentials"])
+					mu.Unlock()
+					if req.Auth["credentials"] == tt.rejected {
+						return []bolt.Message{bolt.Failure{Metadata: packstream.Dictionary{"code": expired.Code, "message": "expired"}}}
+					}
+				}
+				return (&fakeQuery{}).handle(req)
+			})
+			s.Versions = []bolt.Version{{Major: 5, Minor: 1}}
+			s.Start()
+			t.Cleanup(s.Close)
+
+			tokens := 0
+			m := &notifiedAuthManager{AuthTokenManager: ExpiringAuthTokenManager(func(context.Context) (AuthToken, time.Time, error) {
+				tokens++
+				return BearerAuth(fmt.Sprintf("token%d", tokens)), time.Time{}, nil
+			})}
+
+			d, err := NewDriver("bolt://"+s.Addr(), func(c *Config) { c.AuthManager = m })
+			if err != nil {
+				t.Fatalf("NewDriver() error = %v", err)
+			}
+			defer d.Close()
+			d.retry.sleep = func(context.Context, time.Duration) error { return nil }
+
+			if tt.idle {
+				if err := run(t, d, SessionConfig{}, "RETURN 1"); err != nil {
+					t.Fatalf("run error = %v", err)
+				}
+				// Rotate the token without notifying the wrapper.
+				m.AuthTokenManager.HandleSecurityError(ctx, BearerAuth("token1"), expired)
+			}
+
+			sess := d.NewSession(SessionConfig{})
+			defer sess.Close(ctx)
+
+			_, err = sess.ExecuteWrite(ctx, func(tx *Tx) (interface{}, error) {
+				res, err := tx.Run(ctx, "CREATE (n)", nil)
+				if err != nil {
+					return nil, err
+				}
+				return res.Consume(ctx)
+			})
+			if err != nil {
+				t.Fatalf("Session.ExecuteWrite() error = %v", err)
+			}
+
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if !reflect.DeepEqual(m.notified, tt.wantNotified) {
+				t.Errorf("notified tokens = %v, want %v", m.notified, tt.wantNotified)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !reflect.DeepEqual(logons, tt.wantLogons) {
+				t.Errorf("LOGON credentials = %v, want %v", logons, tt.wantLogons)
+			}
+		})
+	}
+}
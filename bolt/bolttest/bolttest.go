@@ -0,0 +1,218 @@
+// Package bolttest provides a Bolt server for testing clients, in the spirit
+// of net/http/httptest.
+package bolttest
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/mattmeyers/graphdb/bolt"
+)
+
+// Handler returns the responses to a request, in order. A nil slice is
+// answered with a single empty SUCCESS. Handlers of a server are called
+// concurrently when it has several client connections.
+type Handler func(req bolt.Message) []bolt.Message
+
+// Server is a fake Bolt server listening on a loopback address. It performs
+// the handshake and answers every request with the responses of its Handler.
+// Like a real server, it ignores requests following a FAILURE until it
+// receives a RESET, and closes the connection on GOODBYE.
+type Server struct {
+	// Versions are the versions accepted during the handshake. If empty,
+	// bolt.SupportedVersions is used.
+	Versions []bolt.Version
+
+	Handler  Handler
+	Listener net.Listener
+
+	// TLS, if set, makes the server accept only TLS connections using this
+	// configuration. It must contain a certificate.
+	TLS *tls.Config
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewServer starts and returns a new Server. The caller should call Close
+// when finished to shut it down.
+func NewServer(h Handler) *Server {
+	s := NewUnstartedServer(h)
+	s.Start()
+	return s
+}
+
+// NewUnstartedServer returns a new Server that is not yet listening. Its
+// fields may be changed before calling Start.
+func NewUnstartedServer(h Handler) *Server {
+	return &Server{Handler: h}
+}
+
+// Start starts a server from NewUnstartedServer.
+func (s *Server) Start() {
+	if s.Listener == nil {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			panic("bolttest: failed to listen on a port: " + err.Error())
+		}
+		s.Listener = ln
+	}
+	if s.TLS != nil {
+		s.Listener = tls.NewListener(s.Listener, s.TLS)
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			nc, err := s.Listener.Accept()
+			if err != nil {
+				return
+			}
+
+			if !s.track(nc) {
+				nc.Close()
+				return
+			}
+
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				defer s.untrack(nc)
+				s.Serve(nc)
+			}()
+		}
+	}()
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() string {
+	return s.Listener.Addr().String()
+}
+
+// Dial connects to the server regardless of network and addr. Its signature
+// matches net.Dialer.DialContext so it can stand in for a dialer.
+func (s *Server) Dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", s.Addr())
+}
+
+// CloseClientConnections closes all open client connections, simulating a
+// server crash or a network failure.
+func (s *Server) CloseClientConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for nc := range s.conns {
+		nc.Close()
+	}
+}
+
+// Close shuts down the server and blocks until all connections have been
+// handled.
+func (s *Server) Close() {
+	s.Listener.Close()
+
+	s.mu.Lock()
+	for nc := range s.conns {
+		nc.Close()
+	}
+	s.conns = nil
+	s.closed = true
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+func (s *Server) track(nc net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]struct{})
+	}
+	s.conns[nc] = struct{}{}
+
+	return true
+}
+
+func (s *Server) untrack(nc net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.conns, nc)
+}
+
+// Serve handles a single client connection until the client hangs up or
+// sends GOODBYE. The connection is closed on return.
+func (s *Server) Serve(nc net.Conn) error {
+	defer nc.Close()
+
+	versions := s.Versions
+	if len(versions) == 0 {
+		versions = bolt.SupportedVersions
+	}
+
+	v, err := bolt.Negotiate(nc, versions)
+	if err != nil {
+		return err
+	}
+
+	cr := bolt.NewChunkReader(nc)
+	cw := bolt.NewChunkWriter(nc)
+
+	failed := false
+	for {
+		b, err := cr.ReadMessage()
+		if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		req, err := bolt.Decode(b)
+		if err != nil {
+			return err
+		}
+
+		switch req.(type) {
+		case bolt.Goodbye:
+			return nil
+		case bolt.Reset:
+			failed = false
+		}
+
+		var resps []bolt.Message
+		if failed {
+			resps = []bolt.Message{bolt.Ignored{}}
+		} else if s.Handler != nil {
+			resps = s.Handler(req)
+		}
+		if resps == nil {
+			resps = []bolt.Message{bolt.Success{}}
+		}
+
+		for _, resp := range resps {
+			if _, ok := resp.(bolt.Failure); ok {
+				failed = true
+			}
+
+			b, err := bolt.Encode(resp, v)
+			if err != nil {
+				return err
+			}
+			if err := cw.WriteMessage(b); err != nil {
+				return err
+			}
+		}
+	}
+}
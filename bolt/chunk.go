@@ -0,0 +1,120 @@
+package bolt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxChunkSize is the largest chunk payload that fits the two byte header.
+const maxChunkSize = 0xFFFF
+
+var (
+	// ErrMessageTooLarge is returned by ChunkReader.ReadMessage when a message
+	// exceeds the reader's MaxMessageSize.
+	ErrMessageTooLarge = errors.New("bolt: message too large")
+	// ErrTruncatedChunk is returned by ChunkReader.ReadMessage when the input
+	// ends in the middle of a message.
+	ErrTruncatedChunk = errors.New("bolt: truncated chunk")
+)
+
+// A ChunkWriter frames messages into Bolt chunks. Each message is split into
+// chunks of at most 65,535 bytes, each preceded by its big endian size, and
+// followed by an empty chunk marking the end of the message.
+type ChunkWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+// NewChunkWriter returns a ChunkWriter writing to w.
+func NewChunkWriter(w io.Writer) *ChunkWriter {
+	return &ChunkWriter{w: w}
+}
+
+// WriteMessage writes msg as a sequence of chunks followed by the end marker.
+// The framed message is passed to the underlying writer in a single call.
+func (cw *ChunkWriter) WriteMessage(msg []byte) error {
+	if len(msg) == 0 {
+		return errors.New("bolt: cannot write empty message")
+	}
+
+	cw.buf = cw.buf[:0]
+	for len(msg) > 0 {
+		n := len(msg)
+		if n > maxChunkSize {
+			n = maxChunkSize
+		}
+
+		cw.buf = append(cw.buf, byte(n>>8), byte(n))
+		cw.buf = append(cw.buf, msg[:n]...)
+		msg = msg[n:]
+	}
+	cw.buf = append(cw.buf, 0x00, 0x00)
+
+	_, err := cw.w.Write(cw.buf)
+	return err
+}
+
+// WriteNoop writes an empty chunk outside of any message. Peers ignore NOOP
+// chunks, which makes them suitable as keep-alives.
+func (cw *ChunkWriter) WriteNoop() error {
+	_, err := cw.w.Write([]byte{0x00, 0x00})
+	return err
+}
+
+// A ChunkReader reassembles messages from Bolt chunks.
+type ChunkReader struct {
+	r   io.Reader
+	hdr [2]byte
+
+	// MaxMessageSize limits the size of a reassembled message. Zero means no
+	// limit.
+	MaxMessageSize int
+}
+
+// NewChunkReader returns a ChunkReader reading from r.
+func NewChunkReader(r io.Reader) *ChunkReader {
+	return &ChunkReader{r: r}
+}
+
+// ReadMessage reads chunks up to the end of the next message and returns the
+// message payload. NOOP chunks preceding the message are skipped.
+//
+// ReadMessage returns io.EOF if the input ends cleanly before a message
+// starts and ErrTruncatedChunk if it ends in the middle of one.
+func (cr *ChunkReader) ReadMessage() ([]byte, error) {
+	var msg []byte
+
+	for {
+		if _, err := io.ReadFull(cr.r, cr.hdr[:]); err != nil {
+			if err == io.EOF && msg == nil {
+				return nil, io.EOF
+			} else if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil, ErrTruncatedChunk
+			}
+			return nil, err
+		}
+
+		size := int(binary.BigEndian.Uint16(cr.hdr[:]))
+		if size == 0 {
+			if msg == nil { // NOOP
+				continue
+			}
+			return msg, nil
+		}
+
+		if cr.MaxMessageSize > 0 && len(msg)+size > cr.MaxMessageSize {
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrMessageTooLarge, cr.MaxMessageSize)
+		}
+
+		n := len(msg)
+		msg = append(msg, make([]byte, size)...)
+		if _, err := io.ReadFull(cr.r, msg[n:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil, ErrTruncatedChunk
+			}
+			return nil, err
+		}
+	}
+}
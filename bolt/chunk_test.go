@@ -0,0 +1,146 @@
+package bolt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestChunkWriter_WriteMessage(t *testing.T) {
+	large := bytes.Repeat([]byte{0x01}, maxChunkSize+2)
+
+	tests := []struct {
+		name    string
+		msg     []byte
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name:    "single chunk",
+			msg:     []byte{0xB0, 0x02},
+			want:    []byte{0x00, 0x02, 0xB0, 0x02, 0x00, 0x00},
+			wantErr: false,
+		},
+		{
+			name:    "split across chunks",
+			msg:     large,
+			want:    append(append(append([]byte{0xFF, 0xFF}, large[:maxChunkSize]...), 0x00, 0x02, 0x01, 0x01), 0x00, 0x00),
+			wantErr: false,
+		},
+		{
+			name:    "empty message",
+			msg:     []byte{},
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			err := NewChunkWriter(buf).WriteMessage(tt.msg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ChunkWriter.WriteMessage() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(buf.Bytes(), tt.want) {
+				t.Errorf("ChunkWriter.WriteMessage() wrote %d bytes, want %d", buf.Len(), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestChunkReader_ReadMessage_pipe(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	msgs := [][]byte{
+		{0xB0, 0x02},
+		bytes.Repeat([]byte{0x42}, 3*maxChunkSize+10),
+		{0xB1, 0x71, 0x90},
+	}
+
+	go func() {
+		defer server.Close()
+
+		cw := NewChunkWriter(server)
+		for _, m := range msgs {
+			if err := cw.WriteNoop(); err != nil {
+				return
+			}
+			if err := cw.WriteMessage(m); err != nil {
+				return
+			}
+		}
+	}()
+
+	cr := NewChunkReader(client)
+	for i, want := range msgs {
+		got, err := cr.ReadMessage()
+		if err != nil {
+			t.Fatalf("ChunkReader.ReadMessage() %d error = %v", i, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("ChunkReader.ReadMessage() %d = %d bytes, want %d", i, len(got), len(want))
+		}
+	}
+
+	if _, err := cr.ReadMessage(); err != io.EOF {
+		t.Errorf("ChunkReader.ReadMessage() error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestChunkReader_ReadMessage_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		max     int
+		wantErr error
+	}{
+		{
+			name:    "truncated header",
+			data:    []byte{0x00, 0x02, 0xB0, 0x02, 0x00},
+			wantErr: ErrTruncatedChunk,
+		},
+		{
+			name:    "truncated payload",
+			data:    []byte{0x00, 0x04, 0xB0, 0x02},
+			wantErr: ErrTruncatedChunk,
+		},
+		{
+			name:    "missing end marker",
+			data:    []byte{0x00, 0x02, 0xB0, 0x02},
+			wantErr: ErrTruncatedChunk,
+		},
+		{
+			name:    "message too large",
+			data:    []byte{0x00, 0x02, 0xB0, 0x02, 0x00, 0x02, 0xB0, 0x02, 0x00, 0x00},
+			max:     3,
+			wantErr: ErrMessageTooLarge,
+		},
+		{
+			name:    "only noops",
+			data:    []byte{0x00, 0x00, 0x00, 0x00},
+			wantErr: io.EOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+
+			go func() {
+				server.Write(tt.data)
+				server.Close()
+			}()
+
+			cr := NewChunkReader(client)
+			cr.MaxMessageSize = tt.max
+			if _, err := cr.ReadMessage(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ChunkReader.ReadMessage() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,705 @@
+package bolt
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"time"
+
+	"github.com/mattmeyers/graphdb/packstream"
+)
+
+// State is the state of a connection in the Bolt server state machine.
+type State int
+
+const (
+	Connected State = iota
+	Authentication
+	Ready
+	Streaming
+	TxReady
+	TxStreaming
+	Failed
+	Interrupted
+	Defunct
+)
+
+var stateNames = [...]string{
+	Connected:      "CONNECTED",
+	Authentication: "AUTHENTICATION",
+	Ready:          "READY",
+	Streaming:      "STREAMING",
+	TxReady:        "TX_READY",
+	TxStreaming:    "TX_STREAMING",
+	Failed:         "FAILED",
+	Interrupted:    "INTERRUPTED",
+	Defunct:        "DEFUNCT",
+}
+
+func (s State) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+
+	return stateNames[s]
+}
+
+// errIgnored is returned when the server answers a request with IGNORED.
+var errIgnored = errors.New("bolt: request ignored by server")
+
+// Conn is a client connection to a Bolt server. It mirrors the server state
+// machine and refuses requests the server would reject in the current state
+// with a *StateError.
+//
+// Requests are sent one at a time and their responses read before the next
+// request, except for PULL and DISCARD whose responses are read with Fetch. A
+// Conn is not safe for concurrent use.
+//
+// Blocking operations are bound by their context. When it is done while
+// waiting for a response, the server is asked to abandon the outstanding
+// requests with RESET and the connection is left INTERRUPTED until Reset
+// reads the remaining responses. A connection that stopped in the middle of
+// a message cannot be recovered and is closed.
+type Conn struct {
+	nc *meteredConn
+	// br buffers the reads from nc so that small messages, such as the
+	// records of a result, do not each take a read from the network.
+	br      *bufio.Reader
+	cw      *ChunkWriter
+	cr      *ChunkReader
+	version Version
+	state   State
+
+	// pending counts the requests whose summary has not been read yet.
+	pending int
+
+	// deadline is the deadline last set on nc. The watcher started by
+	// begin for the context whose Done channel is watching runs until
+	// unwatch is called, which may be after several operations, e.g. the
+	// Fetch calls reading a batch of records.
+	deadline time.Time
+	watching <-chan struct{}
+	unwatch  func()
+}
+
+// NewConn performs the handshake over nc, proposing the given versions or
+// DefaultVersions if there are none, and returns a connection in the
+// CONNECTED state. Hello must be called before any other request.
+func NewConn(ctx context.Context, nc net.Conn, proposals ...VersionRange) (*Conn, error) {
+	mc := &meteredConn{Conn: nc}
+	br := bufio.NewReader(mc)
+	c := &Conn{
+		nc:    mc,
+		br:    br,
+		cw:    NewChunkWriter(mc),
+		cr:    NewChunkReader(br),
+		state: Connected,
+		// The deadline left by the caller, e.g. after a TLS handshake, is
+		// not known and always replaced.
+		deadline: aLongTimeAgo,
+	}
+
+	if err := c.begin(ctx); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	defer c.end()
+
+	v, err := Handshake(mc, proposals...)
+	if err != nil {
+		nc.Close()
+		if cerr := cancelled(ctx, err); cerr != nil {
+			return nil, cerr
+		}
+		return nil, err
+	}
+	c.version = v
+
+	return c, nil
+}
+
+// Version returns the negotiated protocol version.
+func (c *Conn) Version() Version { return c.version }
+
+// State returns the current state of the connection.
+func (c *Conn) State() State { return c.state }
+
+// Hello initializes the connection and moves it to READY. The auth token is
+// sent in HELLO before Bolt 5.1 and in a separate LOGON afterwards. From Bolt
+// 5.3 the bolt_agent required by the server is added unless extra has one.
+// The metadata of the HELLO SUCCESS, which describes the server, is returned.
+func (c *Conn) Hello(ctx context.Context, extra, auth packstream.Dictionary) (packstream.Dictionary, error) {
+	if err := c.check("HELLO", Connected); err != nil {
+		return nil, err
+	}
+
+	logon := c.SupportsReauth()
+
+	hello := make(packstream.Dictionary, len(extra)+len(auth))
+	for k, v := range extra {
+		hello[k] = v
+	}
+	if !logon {
+		for k, v := range auth {
+			hello[k] = v
+		}
+	}
+	if _, ok := hello["bolt_agent"]; !ok && !c.version.Before(Version{Major: 5, Minor: 3}) {
+		hello["bolt_agent"] = boltAgent()
+	}
+
+	meta, err := c.roundTrip(ctx, Hello{Extra: hello})
+	if err != nil {
+		// The server closes the connection after a failed initialization.
+		c.close()
+		return nil, err
+	}
+
+	if !logon {
+		c.state = Ready
+		return meta, nil
+	}
+
+	c.state = Authentication
+	if err := c.Logon(ctx, auth); err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+}
+
+// boltAgent describes this package to servers from Bolt 5.3.
+func boltAgent() packstream.Dictionary {
+	return packstream.Dictionary{
+		"product":  "graphdb",
+		"platform": runtime.GOOS + "; " + runtime.GOARCH,
+		"language": "Go/" + runtime.Version(),
+	}
+}
+
+// SupportsReauth reports whether the connection can change its credentials
+// with Logoff and Logon, which requires Bolt 5.1.
+func (c *Conn) SupportsReauth() bool {
+	return !c.version.Before(Version{Major: 5, Minor: 1})
+}
+
+// Logoff discards the credentials of the connection, moving it to
+// AUTHENTICATION until Logon is called.
+func (c *Conn) Logoff(ctx context.Context) error {
+	if err := c.check("LOGOFF", Ready); err != nil {
+		return err
+	}
+	if !c.SupportsReauth() {
+		return fmt.Errorf("bolt: LOGOFF is not supported by Bolt %s", c.version)
+	}
+
+	if _, err := c.roundTrip(ctx, Logoff{}); err != nil {
+		return err
+	}
+	c.state = Authentication
+
+	return nil
+}
+
+// Logon authenticates the connection with the given auth token, moving it
+// to READY. The server closes the connection if authentication fails.
+func (c *Conn) Logon(ctx context.Context, auth packstream.Dictionary) error {
+	if err := c.check("LOGON", Authentication); err != nil {
+		return err
+	}
+
+	if _, err := c.roundTrip(ctx, Logon{Auth: auth}); err != nil {
+		c.close()
+		return err
+	}
+	c.state = Ready
+
+	return nil
+}
+
+// Run submits a query and returns the metadata of its SUCCESS, which holds
+// the fields of the result. Records are then requested with Pull or
+// dropped with Discard.
+func (c *Conn) Run(ctx context.Context, query string, params, extra packstream.Dictionary) (packstream.Dictionary, error) {
+	if err := c.check("RUN", Ready, TxReady); err != nil {
+		return nil, err
+	}
+
+	meta, err := c.roundTrip(ctx, Run{Query: query, Parameters: params, Extra: extra})
+	if err != nil {
+		return nil, err
+	}
+
+	if c.state == Ready {
+		c.state = Streaming
+	} else {
+		c.state = TxStreaming
+	}
+
+	return meta, nil
+}
+
+// Pull requests up to n records, or all if n is -1, of the result identified
+// by qid, where -1 denotes the last result. The records and the closing
+// summary are read with Fetch.
+func (c *Conn) Pull(ctx context.Context, n, qid int64) error {
+	return c.stream(ctx, "PULL", Pull{Extra: streamExtra(n, qid)})
+}
+
+// Discard drops up to n records, or all if n is -1, of the result identified
+// by qid, where -1 denotes the last result. The closing summary is read with
+// Fetch.
+func (c *Conn) Discard(ctx context.Context, n, qid int64) error {
+	return c.stream(ctx, "DISCARD", Discard{Extra: streamExtra(n, qid)})
+}
+
+func streamExtra(n, qid int64) packstream.Dictionary {
+	extra := packstream.Dictionary{"n": n}
+	if qid != -1 {
+		extra["qid"] = qid
+	}
+
+	return extra
+}
+
+func (c *Conn) stream(ctx context.Context, name string, m Message) error {
+	if err := c.check(name, Streaming, TxStreaming); err != nil {
+		return err
+	}
+	if c.pending > 0 {
+		return fmt.Errorf("bolt: cannot send %s before the previous batch has been fetched", name)
+	}
+
+	// The context stays watched until the batch has been fetched, unless
+	// Fetch is called with another one.
+	if err := c.begin(ctx); err != nil {
+		return err
+	}
+
+	if err := c.send(ctx, m); err != nil {
+		c.end()
+		return err
+	}
+	c.pending++
+
+	return nil
+}
+
+// Fetch reads the next response to an outstanding PULL or DISCARD. It returns
+// either the values of a record, or the metadata of the SUCCESS closing the
+// batch. Once a batch ends without has_more set, the result is complete and
+// the connection returns to READY or TX_READY.
+func (c *Conn) Fetch(ctx context.Context) (packstream.List, packstream.Dictionary, error) {
+	if c.state == Interrupted {
+		return nil, nil, errors.New("bolt: cannot fetch from an interrupted connection")
+	}
+	if c.pending == 0 {
+		return nil, nil, errors.New("bolt: no outstanding PULL or DISCARD")
+	}
+
+	if err := c.begin(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	m, err := c.receive(ctx)
+	if err != nil {
+		c.end()
+		return nil, nil, err
+	}
+
+	if r, ok := m.(Record); ok {
+		return r.Data, nil, nil
+	}
+	c.end()
+
+	meta, err := c.summary(m)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if hasMore, _ := meta["has_more"].(bool); !hasMore {
+		if c.state == Streaming {
+			c.state = Ready
+		} else {
+			c.state = TxReady
+		}
+	}
+
+	return nil, meta, nil
+}
+
+// Begin starts an explicit transaction, moving the connection to TX_READY.
+func (c *Conn) Begin(ctx context.Context, extra packstream.Dictionary) error {
+	if err := c.check("BEGIN", Ready); err != nil {
+		return err
+	}
+
+	if _, err := c.roundTrip(ctx, Begin{Extra: extra}); err != nil {
+		return err
+	}
+	c.state = TxReady
+
+	return nil
+}
+
+// Commit commits the explicit transaction and returns the metadata of its
+// SUCCESS, which holds the bookmark.
+func (c *Conn) Commit(ctx context.Context) (packstream.Dictionary, error) {
+	if err := c.check("COMMIT", TxReady); err != nil {
+		return nil, err
+	}
+
+	meta, err := c.roundTrip(ctx, Commit{})
+	if err != nil {
+		return nil, err
+	}
+	c.state = Ready
+
+	return meta, nil
+}
+
+// Rollback rolls back the explicit transaction.
+func (c *Conn) Rollback(ctx context.Context) error {
+	if err := c.check("ROLLBACK", TxReady); err != nil {
+		return err
+	}
+
+	if _, err := c.roundTrip(ctx, Rollback{}); err != nil {
+		return err
+	}
+	c.state = Ready
+
+	return nil
+}
+
+// Route requests the routing table for a database and returns the metadata
+// of the SUCCESS, which holds the table under the rt key.
+func (c *Conn) Route(ctx context.Context, routing packstream.Dictionary, bookmarks packstream.List, extra packstream.Dictionary) (packstream.Dictionary, error) {
+	if err := c.check("ROUTE", Ready); err != nil {
+		return nil, err
+	}
+
+	return c.roundTrip(ctx, Route{Routing: routing, Bookmarks: bookmarks, Extra: extra})
+}
+
+// Reset interrupts any outstanding work, discarding unread records, and
+// returns the connection to READY. Open transactions are rolled back. Reset
+// is the only way out of the FAILED and INTERRUPTED states.
+func (c *Conn) Reset(ctx context.Context) error {
+	if c.state == Connected || c.state == Defunct {
+		return &StateError{Request: "RESET", State: c.state}
+	}
+
+	if err := c.begin(ctx); err != nil {
+		return err
+	}
+	defer c.end()
+
+	// An interrupted connection has already sent its RESET.
+	if c.state != Interrupted {
+		if err := c.send(ctx, Reset{}); err != nil {
+			return err
+		}
+		c.pending++
+		c.state = Interrupted
+	}
+
+	// Drain the responses to any outstanding requests. The last summary
+	// belongs to the RESET.
+	var last Message
+	for c.pending > 0 {
+		m, err := c.receive(ctx)
+		if err != nil {
+			return err
+		}
+		if _, ok := m.(Record); ok {
+			continue
+		}
+		c.pending--
+		last = m
+	}
+
+	if f, ok := last.(Failure); ok {
+		c.close()
+		return newNeo4jError(f.Metadata)
+	} else if _, ok := last.(Success); !ok {
+		c.close()
+		return fmt.Errorf("bolt: unexpected %T in response to RESET", last)
+	}
+
+	c.state = Ready
+
+	return nil
+}
+
+// Close sends GOODBYE if the connection is usable and closes it, leaving it
+// DEFUNCT.
+func (c *Conn) Close() error {
+	if c.state == Defunct {
+		return nil
+	}
+
+	if c.state != Connected {
+		// The server closes the connection without responding, so any
+		// error is of no interest.
+		c.nc.SetWriteDeadline(time.Now().Add(time.Second))
+		if b, err := Encode(Goodbye{}, c.version); err == nil {
+			c.cw.WriteMessage(b)
+		}
+	}
+
+	return c.close()
+}
+
+func (c *Conn) close() error {
+	c.end()
+	c.state = Defunct
+	return c.nc.Close()
+}
+
+// check returns a *StateError unless the connection is in one of states.
+func (c *Conn) check(request string, states ...State) error {
+	for _, s := range states {
+		if c.state == s {
+			return nil
+		}
+	}
+
+	return &StateError{Request: request, State: c.state}
+}
+
+// begin prepares the connection for a blocking operation bound by ctx. The
+// socket deadline is set to the deadline of ctx, and moved to the past if
+// ctx is cancelled to unblock pending I/O. end must be called when the
+// operation is over. Operations continuing an exchange with the same ctx,
+// such as the Fetch calls of a batch, reuse the watcher of the first.
+func (c *Conn) begin(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := ctx.Done()
+	if done != nil && done == c.watching {
+		return nil
+	}
+	c.end()
+
+	deadline, _ := ctx.Deadline()
+	if err := c.setDeadline(deadline); err != nil {
+		return err
+	}
+
+	if done == nil {
+		return nil
+	}
+
+	stop, exited := make(chan struct{}), make(chan struct{})
+	var fired bool
+	go func() {
+		defer close(exited)
+		select {
+		case <-done:
+			c.nc.SetDeadline(aLongTimeAgo)
+			fired = true
+		case <-stop:
+		}
+	}()
+	c.watching = done
+	c.unwatch = func() {
+		close(stop)
+		<-exited
+		if fired {
+			c.deadline = aLongTimeAgo
+		}
+	}
+
+	return nil
+}
+
+// end stops watching the context of the operation started by begin. It may
+// be called more than once.
+func (c *Conn) end() {
+	if c.unwatch != nil {
+		c.unwatch()
+		c.unwatch = nil
+		c.watching = nil
+	}
+}
+
+// setDeadline sets the deadline of the socket unless it is already set.
+func (c *Conn) setDeadline(t time.Time) error {
+	if t.Equal(c.deadline) {
+		return nil
+	}
+
+	if err := c.nc.SetDeadline(t); err != nil {
+		return err
+	}
+	c.deadline = t
+
+	return nil
+}
+
+// aLongTimeAgo is a deadline in the past, which makes I/O fail immediately.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// cancelled returns the error of ctx if it is the cause of the I/O error
+// err. Only the deadlines set by begin make I/O time out, so a timeout means
+// ctx is done, or about to be if its deadline has just passed.
+func cancelled(ctx context.Context, err error) error {
+	var ne net.Error
+	if ctx.Done() == nil || !errors.As(err, &ne) || !ne.Timeout() {
+		return nil
+	}
+
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// interrupt asks the server to abandon the outstanding requests after an
+// operation was cancelled between two messages, leaving the connection
+// INTERRUPTED until Reset reads the remaining responses. The connection is
+// closed if the RESET cannot be sent.
+func (c *Conn) interrupt() {
+	if c.state == Interrupted {
+		return
+	}
+
+	// The context is done, so it must no longer move the deadline.
+	c.end()
+	c.setDeadline(time.Now().Add(time.Second))
+	defer c.setDeadline(time.Time{})
+
+	b, err := Encode(Reset{}, c.version)
+	if err == nil {
+		err = c.cw.WriteMessage(b)
+	}
+	if err != nil {
+		c.close()
+		return
+	}
+
+	c.pending++
+	c.state = Interrupted
+}
+
+// roundTrip sends m and reads its summary.
+func (c *Conn) roundTrip(ctx context.Context, m Message) (packstream.Dictionary, error) {
+	if err := c.begin(ctx); err != nil {
+		return nil, err
+	}
+	defer c.end()
+
+	if err := c.send(ctx, m); err != nil {
+		return nil, err
+	}
+	c.pending++
+
+	resp, err := c.receive(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.summary(resp)
+}
+
+// summary handles the response closing a request. A FAILURE moves the
+// connection to FAILED and is returned as a *Neo4jError.
+func (c *Conn) summary(m Message) (packstream.Dictionary, error) {
+	switch m := m.(type) {
+	case Success:
+		c.pending--
+		return m.Metadata, nil
+	case Failure:
+		c.pending--
+		c.state = Failed
+		return nil, newNeo4jError(m.Metadata)
+	case Ignored:
+		c.pending--
+		return nil, errIgnored
+	}
+
+	c.close()
+	return nil, fmt.Errorf("bolt: unexpected %T in response", m)
+}
+
+// send encodes and writes m. Write errors leave the connection DEFUNCT,
+// unless ctx was done before any of m was written.
+func (c *Conn) send(ctx context.Context, m Message) error {
+	b, err := Encode(m, c.version)
+	if err != nil {
+		return err
+	}
+
+	n := c.nc.n
+	if err := c.cw.WriteMessage(b); err != nil {
+		cerr := cancelled(ctx, err)
+		if cerr == nil || c.nc.n != n {
+			c.close()
+		}
+		if cerr != nil {
+			return cerr
+		}
+		return err
+	}
+
+	return nil
+}
+
+// receive reads and decodes the next message. Read errors leave the
+// connection DEFUNCT, unless ctx was done before any of the message was
+// read, in which case the connection is interrupted.
+func (c *Conn) receive(ctx context.Context) (Message, error) {
+	n := c.consumed()
+	b, err := c.cr.ReadMessage()
+	if err != nil {
+		cerr := cancelled(ctx, err)
+		if cerr == nil {
+			c.close()
+			return nil, err
+		}
+
+		if c.consumed() == n {
+			c.interrupt()
+		} else {
+			c.close()
+		}
+		return nil, cerr
+	}
+
+	m, err := Decode(b)
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// consumed returns a count that changes whenever messages are read, i.e.
+// the bytes received over the connection less those still buffered.
+func (c *Conn) consumed() int64 {
+	return c.nc.n - int64(c.br.Buffered())
+}
+
+// meteredConn counts the bytes transferred over a connection, which tells
+// whether an interrupted operation stopped in the middle of a message.
+type meteredConn struct {
+	net.Conn
+	n int64
+}
+
+func (c *meteredConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *meteredConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,657 @@
+package bolt_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattmeyers/graphdb/bolt"
+	"github.com/mattmeyers/graphdb/bolt/bolttest"
+	"github.com/mattmeyers/graphdb/packstream"
+)
+
+// handler answers RUN with a single field and PULL with the given records.
+func handler(records ...packstream.List) bolttest.Handler {
+	return func(req bolt.Message) []bolt.Message {
+		switch req := req.(type) {
+		case bolt.Run:
+			if req.Query == "fail" {
+				return []bolt.Message{bolt.Failure{Metadata: packstream.Dictionary{
+					"code":    "Neo.ClientError.Statement.SyntaxError",
+					"message": "Invalid input",
+				}}}
+			}
+			return []bolt.Message{bolt.Success{Metadata: packstream.Dictionary{"fields": packstream.List{"n"}}}}
+		case bolt.Pull:
+			var resps []bolt.Message
+			for _, r := range records {
+				resps = append(resps, bolt.Record{Data: r})
+			}
+			return append(resps, bolt.Success{Metadata: packstream.Dictionary{"has_more": false}})
+		}
+		return nil
+	}
+}
+
+// dial starts s and returns an initialized connection to it.
+func dial(t *testing.T, s *bolttest.Server) *bolt.Conn {
+	t.Helper()
+
+	s.Start()
+	t.Cleanup(s.Close)
+
+	ctx := context.Background()
+	nc, err := s.Dial(ctx, "tcp", "")
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+
+	c, err := bolt.NewConn(ctx, nc)
+	if err != nil {
+		t.Fatalf("NewConn() error = %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	if _, err := c.Hello(ctx, packstream.Dictionary{"user_agent": "test"}, packstream.Dictionary{"scheme": "none"}); err != nil {
+		t.Fatalf("Conn.Hello() error = %v", err)
+	}
+
+	return c
+}
+
+func fetchAll(ctx context.Context, c *bolt.Conn) ([]packstream.List, packstream.Dictionary, error) {
+	var records []packstream.List
+	for {
+		values, meta, err := c.Fetch(ctx)
+		if err != nil {
+			return records, nil, err
+		}
+		if meta != nil {
+			return records, meta, nil
+		}
+		records = append(records, values)
+	}
+}
+
+func TestConn_Hello(t *testing.T) {
+	tests := []struct {
+		name      string
+		version   bolt.Version
+		wantAuth  bool
+		wantAgent bool
+		wantReqs  []string
+	}{
+		{
+			name:     "auth in hello before 5.1",
+			version:  bolt.Version{Major: 5, Minor: 0},
+			wantReqs: []string{"bolt.Hello"},
+			wantAuth: true,
+		},
+		{
+			name:     "auth in logon from 5.1",
+			version:  bolt.Version{Major: 5, Minor: 1},
+			wantReqs: []string{"bolt.Hello", "bolt.Logon"},
+			wantAuth: false,
+		},
+		{
+			name:      "bolt agent from 5.3",
+			version:   bolt.Version{Major: 5, Minor: 3},
+			wantReqs:  []string{"bolt.Hello", "bolt.Logon"},
+			wantAuth:  false,
+			wantAgent: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var reqs []string
+			var helloAuth bool
+			var agent packstream.Dictionary
+			s := bolttest.NewUnstartedServer(func(req bolt.Message) []bolt.Message {
+				mu.Lock()
+				defer mu.Unlock()
+
+				reqs = append(reqs, reflect.TypeOf(req).String())
+				if h, ok := req.(bolt.Hello); ok {
+					_, helloAuth = h.Extra["scheme"]
+					agent, _ = h.Extra["bolt_agent"].(packstream.Dictionary)
+				}
+				return nil
+			})
+			s.Versions = []bolt.Version{tt.version}
+
+			c := dial(t, s)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if c.State() != bolt.Ready {
+				t.Errorf("Conn.State() = %v, want %v", c.State(), bolt.Ready)
+			}
+			if c.Version() != tt.version {
+				t.Errorf("Conn.Version() = %v, want %v", c.Version(), tt.version)
+			}
+			if !reflect.DeepEqual(reqs, tt.wantReqs) {
+				t.Errorf("requests = %v, want %v", reqs, tt.wantReqs)
+			}
+			if helloAuth != tt.wantAuth {
+				t.Errorf("auth in HELLO = %v, want %v", helloAuth, tt.wantAuth)
+			}
+			if (agent != nil) != tt.wantAgent {
+				t.Errorf("bolt_agent in HELLO = %v, want %v", agent, tt.wantAgent)
+			} else if agent != nil && agent["product"] != "graphdb" {
+				t.Errorf("bolt_agent product = %v, want %v", agent["product"], "graphdb")
+			}
+		})
+	}
+}
+
+func TestConn_autoCommit(t *testing.T) {
+	ctx := context.Background()
+	c := dial(t, bolttest.NewUnstartedServer(handler(packstream.List{int64(1)}, packstream.List{int64(2)})))
+
+	meta, err := c.Run(ctx, "RETURN 1 AS n", nil, nil)
+	if err != nil {
+		t.Fatalf("Conn.Run() error = %v", err)
+	}
+	if want := (packstream.List{"n"}); !reflect.DeepEqual(meta["fields"], want) {
+		t.Errorf("Conn.Run() fields = %v, want %v", meta["fields"], want)
+	}
+	if c.State() != bolt.Streaming {
+		t.Errorf("Conn.State() = %v, want %v", c.State(), bolt.Streaming)
+	}
+
+	if err := c.Pull(ctx, -1, -1); err != nil {
+		t.Fatalf("Conn.Pull() error = %v", err)
+	}
+
+	records, _, err := fetchAll(ctx, c)
+	if err != nil {
+		t.Fatalf("Conn.Fetch() error = %v", err)
+	}
+	if want := []packstream.List{{int64(1)}, {int64(2)}}; !reflect.DeepEqual(records, want) {
+		t.Errorf("Conn.Fetch() records = %v, want %v", records, want)
+	}
+	if c.State() != bolt.Ready {
+		t.Errorf("Conn.State() = %v, want %v", c.State(), bolt.Ready)
+	}
+}
+
+// graphRecord returns a record holding a node, a relationship and a path,
+// with element IDs if ids is set.
+func graphRecord(ids bool) packstream.List {
+	elementID := func(id string) string {
+		if !ids {
+			return ""
+		}
+		return id
+	}
+
+	alice := packstream.Node{ID: 1, Labels: packstream.List{"Person"}, Properties: packstream.Dictionary{"name": "Alice"}, ElementID: elementID("4:db:1")}
+	bob := packstream.Node{ID: 2, Labels: packstream.List{"Person"}, Properties: packstream.Dictionary{"name": "Bob"}, ElementID: elementID("4:db:2")}
+	knows := packstream.Relationship{
+		ID:                 3,
+		StartNodeID:        1,
+		EndNodeID:          2,
+		Type:               "KNOWS",
+		Properties:         packstream.Dictionary{},
+		ElementID:          elementID("5:db:3"),
+		StartNodeElementID: elementID("4:db:1"),
+		EndNodeElementID:   elementID("4:db:2"),
+	}
+	path := packstream.Path{
+		Nodes: packstream.List{alice, bob},
+		Rels:  packstream.List{packstream.UnboundRelationship{ID: 3, Type: "KNOWS", Properties: packstream.Dictionary{}, ElementID: elementID("5:db:3")}},
+		IDs:   packstream.List{int64(1), int64(1)},
+	}
+
+	return packstream.List{alice, knows, path}
+}
+
+func TestConn_graphStructures(t *testing.T) {
+	tests := []struct {
+		name    string
+		version bolt.Version
+		want    packstream.List
+	}{
+		{
+			name:    "legacy structures",
+			version: bolt.Version{Major: 4, Minor: 4},
+			want:    graphRecord(false),
+		},
+		{
+			name:    "element ids from 5.0",
+			version: bolt.Version{Major: 5, Minor: 0},
+			want:    graphRecord(true),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := bolttest.NewUnstartedServer(handler(graphRecord(true)))
+			s.Versions = []bolt.Version{tt.version}
+			c := dial(t, s)
+
+			if _, err := c.Run(ctx, "MATCH p = (a)-[r]->() RETURN a, r, p", nil, nil); err != nil {
+				t.Fatalf("Conn.Run() error = %v", err)
+			}
+			if err := c.Pull(ctx, -1, -1); err != nil {
+				t.Fatalf("Conn.Pull() error = %v", err)
+			}
+
+			records, _, err := fetchAll(ctx, c)
+			if err != nil {
+				t.Fatalf("Conn.Fetch() error = %v", err)
+			}
+			if want := []packstream.List{tt.want}; !reflect.DeepEqual(records, want) {
+				t.Errorf("Conn.Fetch() records = %#v, want %#v", records, want)
+			}
+		})
+	}
+}
+
+func TestConn_transaction(t *testing.T) {
+	ctx := context.Background()
+	c := dial(t, bolttest.NewUnstartedServer(handler(packstream.List{int64(1)})))
+
+	if err := c.Begin(ctx, nil); err != nil {
+		t.Fatalf("Conn.Begin() error = %v", err)
+	}
+	if c.State() != bolt.TxReady {
+		t.Errorf("Conn.State() = %v, want %v", c.State(), bolt.TxReady)
+	}
+
+	if _, err := c.Run(ctx, "RETURN 1 AS n", nil, nil); err != nil {
+		t.Fatalf("Conn.Run() error = %v", err)
+	}
+	if c.State() != bolt.TxStreaming {
+		t.Errorf("Conn.State() = %v, want %v", c.State(), bolt.TxStreaming)
+	}
+
+	if err := c.Pull(ctx, -1, -1); err != nil {
+		t.Fatalf("Conn.Pull() error = %v", err)
+	}
+	if _, _, err := fetchAll(ctx, c); err != nil {
+		t.Fatalf("Conn.Fetch() error = %v", err)
+	}
+	if c.State() != bolt.TxReady {
+		t.Errorf("Conn.State() = %v, want %v", c.State(), bolt.TxReady)
+	}
+
+	if _, err := c.Commit(ctx); err != nil {
+		t.Fatalf("Conn.Commit() error = %v", err)
+	}
+	if c.State() != bolt.Ready {
+		t.Errorf("Conn.State() = %v, want %v", c.State(), bolt.Ready)
+	}
+}
+
+func TestConn_stateErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(ctx context.Context, c *bolt.Conn) error
+		request func(ctx context.Context, c *bolt.Conn) error
+		want    bolt.StateError
+	}{
+		{
+			name: "run while streaming",
+			setup: func(ctx context.Context, c *bolt.Conn) error {
+				_, err := c.Run(ctx, "RETURN 1 AS n", nil, nil)
+				return err
+			},
+			request: func(ctx context.Context, c *bolt.Conn) error {
+				_, err := c.Run(ctx, "RETURN 2 AS n", nil, nil)
+				return err
+			},
+			want: bolt.StateError{Request: "RUN", State: bolt.Streaming},
+		},
+		{
+			name:  "commit outside transaction",
+			setup: func(ctx context.Context, c *bolt.Conn) error { return nil },
+			request: func(ctx context.Context, c *bolt.Conn) error {
+				_, err := c.Commit(ctx)
+				return err
+			},
+			want: bolt.StateError{Request: "COMMIT", State: bolt.Ready},
+		},
+		{
+			name:  "pull without result",
+			setup: func(ctx context.Context, c *bolt.Conn) error { return nil },
+			request: func(ctx context.Context, c *bolt.Conn) error {
+				return c.Pull(ctx, -1, -1)
+			},
+			want: bolt.StateError{Request: "PULL", State: bolt.Ready},
+		},
+		{
+			name:    "begin inside transaction",
+			setup:   func(ctx context.Context, c *bolt.Conn) error { return c.Begin(ctx, nil) },
+			request: func(ctx context.Context, c *bolt.Conn) error { return c.Begin(ctx, nil) },
+			want:    bolt.StateError{Request: "BEGIN", State: bolt.TxReady},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			var mu sync.Mutex
+			var reqs int
+			s := bolttest.NewUnstartedServer(func(req bolt.Message) []bolt.Message {
+				mu.Lock()
+				reqs++
+				mu.Unlock()
+				return handler()(req)
+			})
+			c := dial(t, s)
+
+			if err := tt.setup(ctx, c); err != nil {
+				t.Fatalf("setup error = %v", err)
+			}
+			mu.Lock()
+			sent := reqs
+			mu.Unlock()
+
+			err := tt.request(ctx, c)
+			var se *bolt.StateError
+			if !errors.As(err, &se) {
+				t.Fatalf("error = %v, want *bolt.StateError", err)
+			}
+			if *se != tt.want {
+				t.Errorf("error = %v, want %v", se, &tt.want)
+			}
+
+			// A Reset round trip guarantees the server has processed
+			// anything that might have been sent.
+			if err := c.Reset(ctx); err != nil {
+				t.Fatalf("Conn.Reset() error = %v", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if reqs != sent+1 {
+				t.Errorf("server received %d requests, want %d", reqs-sent-1, 0)
+			}
+		})
+	}
+}
+
+func TestConn_failure(t *testing.T) {
+	ctx := context.Background()
+	c := dial(t, bolttest.NewUnstartedServer(handler()))
+
+	_, err := c.Run(ctx, "fail", nil, nil)
+	var ne *bolt.Neo4jError
+	if !errors.As(err, &ne) {
+		t.Fatalf("Conn.Run() error = %v, want *bolt.Neo4jError", err)
+	}
+	if want := "Neo.ClientError.Statement.SyntaxError"; ne.Code != want {
+		t.Errorf("Neo4jError.Code = %q, want %q", ne.Code, want)
+	}
+	if c.State() != bolt.Failed {
+		t.Errorf("Conn.State() = %v, want %v", c.State(), bolt.Failed)
+	}
+
+	_, err = c.Run(ctx, "RETURN 1 AS n", nil, nil)
+	var se *bolt.StateError
+	if !errors.As(err, &se) || se.State != bolt.Failed {
+		t.Errorf("Conn.Run() error = %v, want StateError in FAILED", err)
+	}
+
+	if err := c.Reset(ctx); err != nil {
+		t.Fatalf("Conn.Reset() error = %v", err)
+	}
+	if c.State() != bolt.Ready {
+		t.Errorf("Conn.State() = %v, want %v", c.State(), bolt.Ready)
+	}
+
+	if _, err := c.Run(ctx, "RETURN 1 AS n", nil, nil); err != nil {
+		t.Errorf("Conn.Run() after Reset error = %v", err)
+	}
+}
+
+func TestConn_Reset(t *testing.T) {
+	ctx := context.Background()
+	c := dial(t, bolttest.NewUnstartedServer(handler(packstream.List{int64(1)}, packstream.List{int64(2)})))
+
+	if _, err := c.Run(ctx, "RETURN 1 AS n", nil, nil); err != nil {
+		t.Fatalf("Conn.Run() error = %v", err)
+	}
+	if err := c.Pull(ctx, -1, -1); err != nil {
+		t.Fatalf("Conn.Pull() error = %v", err)
+	}
+
+	// Reset with the records still unread.
+	if err := c.Reset(ctx); err != nil {
+		t.Fatalf("Conn.Reset() error = %v", err)
+	}
+	if c.State() != bolt.Ready {
+		t.Errorf("Conn.State() = %v, want %v", c.State(), bolt.Ready)
+	}
+
+	if _, err := c.Run(ctx, "RETURN 1 AS n", nil, nil); err != nil {
+		t.Errorf("Conn.Run() after Reset error = %v", err)
+	}
+}
+
+func TestConn_Close(t *testing.T) {
+	c := dial(t, bolttest.NewUnstartedServer(nil))
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Conn.Close() error = %v", err)
+	}
+	if c.State() != bolt.Defunct {
+		t.Errorf("Conn.State() = %v, want %v", c.State(), bolt.Defunct)
+	}
+
+	_, err := c.Run(context.Background(), "RETURN 1 AS n", nil, nil)
+	var se *bolt.StateError
+	if !errors.As(err, &se) {
+		t.Errorf("Conn.Run() error = %v, want *bolt.StateError", err)
+	}
+}
+
+func TestConn_reauth(t *testing.T) {
+	ctx := context.Background()
+
+	s := bolttest.NewUnstartedServer(nil)
+	s.Versions = []bolt.Version{{Major: 5, Minor: 1}}
+	c := dial(t, s)
+
+	if err := c.Logoff(ctx); err != nil {
+		t.Fatalf("Conn.Logoff() error = %v", err)
+	}
+	if c.State() != bolt.Authentication {
+		t.Errorf("Conn.State() = %v, want %v", c.State(), bolt.Authentication)
+	}
+
+	_, err := c.Run(ctx, "RETURN 1 AS n", nil, nil)
+	var se *bolt.StateError
+	if !errors.As(err, &se) {
+		t.Errorf("Conn.Run() error = %v, want *bolt.StateError", err)
+	}
+
+	if err := c.Logon(ctx, packstream.Dictionary{"scheme": "bearer", "credentials": "token"}); err != nil {
+		t.Fatalf("Conn.Logon() error = %v", err)
+	}
+	if c.State() != bolt.Ready {
+		t.Errorf("Conn.State() = %v, want %v", c.State(), bolt.Ready)
+	}
+}
+
+func TestConn_Logoff_unsupported(t *testing.T) {
+	s := bolttest.NewUnstartedServer(nil)
+	s.Versions = []bolt.Version{{Major: 5, Minor: 0}}
+	c := dial(t, s)
+
+	if c.SupportsReauth() {
+		t.Errorf("Conn.SupportsReauth() = true, want false")
+	}
+	if err := c.Logoff(context.Background()); err == nil {
+		t.Errorf("Conn.Logoff() error = nil, want error")
+	}
+	if c.State() != bolt.Ready {
+		t.Errorf("Conn.State() = %v, want %v", c.State(), bolt.Ready)
+	}
+}
+
+// slowHandler answers like handler, except that PULL is held up until
+// unblock is closed.
+func slowHandler(unblock <-chan struct{}, records ...packstream.List) bolttest.Handler {
+	h := handler(records...)
+	return func(req bolt.Message) []bolt.Message {
+		if _, ok := req.(bolt.Pull); ok {
+			<-unblock
+		}
+		return h(req)
+	}
+}
+
+func TestConn_cancel(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctx     func() (context.Context, context.CancelFunc)
+		wantErr error
+	}{
+		{
+			name: "cancelled",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(20*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			wantErr: context.Canceled,
+		},
+		{
+			name: "deadline",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 20*time.Millisecond)
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unblock := make(chan struct{})
+			c := dial(t, bolttest.NewUnstartedServer(slowHandler(unblock, packstream.List{int64(1)})))
+			defer close(unblock)
+
+			ctx, cancel := tt.ctx()
+			defer cancel()
+
+			if _, err := c.Run(ctx, "RETURN 1", nil, nil); err != nil {
+				t.Fatalf("Conn.Run() error = %v", err)
+			}
+			if err := c.Pull(ctx, -1, -1); err != nil {
+				t.Fatalf("Conn.Pull() error = %v", err)
+			}
+
+			start := time.Now()
+			_, _, err := c.Fetch(ctx)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Conn.Fetch() error = %v, want %v", err, tt.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Conn.Fetch() took %v", elapsed)
+			}
+			if c.State() != bolt.Interrupted {
+				t.Fatalf("Conn.State() = %v, want %v", c.State(), bolt.Interrupted)
+			}
+			if _, _, err := c.Fetch(context.Background()); err == nil {
+				t.Error("Conn.Fetch() expected error on interrupted connection")
+			}
+
+			// The server answers the RESET once the PULL is done.
+			unblock <- struct{}{}
+			if err := c.Reset(context.Background()); err != nil {
+				t.Fatalf("Conn.Reset() error = %v", err)
+			}
+			if c.State() != bolt.Ready {
+				t.Errorf("Conn.State() = %v, want %v", c.State(), bolt.Ready)
+			}
+
+			// Requests other than the held up PULL are answered at once.
+			if _, err := c.Run(context.Background(), "RETURN 1", nil, nil); err != nil {
+				t.Fatalf("Conn.Run() after Reset error = %v", err)
+			}
+		})
+	}
+}
+
+func TestConn_cancelBeforeSend(t *testing.T) {
+	c := dial(t, bolttest.NewUnstartedServer(handler()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := c.Run(ctx, "RETURN 1", nil, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Conn.Run() error = %v, want %v", err, context.Canceled)
+	}
+	if c.State() != bolt.Ready {
+		t.Errorf("Conn.State() = %v, want %v", c.State(), bolt.Ready)
+	}
+}
+
+// deadlineConn counts the calls to SetDeadline.
+type deadlineConn struct {
+	net.Conn
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (c *deadlineConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.calls++
+	c.mu.Unlock()
+
+	return c.Conn.SetDeadline(t)
+}
+
+func TestConn_deadlinePerExchange(t *testing.T) {
+	records := make([]packstream.List, 50)
+	for i := range records {
+		records[i] = packstream.List{int64(i)}
+	}
+
+	s := bolttest.NewServer(handler(records...))
+	t.Cleanup(s.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	nc, err := s.Dial(ctx, "tcp", "")
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	dc := &deadlineConn{Conn: nc}
+
+	c, err := bolt.NewConn(ctx, dc)
+	if err != nil {
+		t.Fatalf("NewConn() error = %v", err)
+	}
+	defer c.Close()
+
+	if _, err := c.Hello(ctx, packstream.Dictionary{"user_agent": "test"}, packstream.Dictionary{"scheme": "none"}); err != nil {
+		t.Fatalf("Conn.Hello() error = %v", err)
+	}
+	if _, err := c.Run(ctx, "RETURN 1", nil, nil); err != nil {
+		t.Fatalf("Conn.Run() error = %v", err)
+	}
+	if err := c.Pull(ctx, -1, -1); err != nil {
+		t.Fatalf("Conn.Pull() error = %v", err)
+	}
+	got, _, err := fetchAll(ctx, c)
+	if err != nil {
+		t.Fatalf("Conn.Fetch() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, records) {
+		t.Errorf("Conn.Fetch() = %v, want %v", got, records)
+	}
+
+	// The deadline of ctx is set once and kept for every operation.
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if dc.calls != 1 {
+		t.Errorf("SetDeadline() calls = %d, want 1", dc.calls)
+	}
+}
@@ -0,0 +1,177 @@
+package bolt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mattmeyers/graphdb/packstream"
+)
+
+// Classification is the broad kind of a Neo4jError, taken from the second
+// part of its code.
+type Classification string
+
+const (
+	// ClientError is caused by the request, e.g. a syntax error or a
+	// constraint violation. Retrying the same request fails again.
+	ClientError Classification = "ClientError"
+
+	// TransientError is a temporary failure, e.g. a deadlock or a leader
+	// switch. Retrying the request may succeed.
+	TransientError Classification = "TransientError"
+
+	// DatabaseError is a failure of the database itself.
+	DatabaseError Classification = "DatabaseError"
+)
+
+// Neo4jError is an error reported by the server in a FAILURE message. It is
+// the only error type the Bolt layer uses for server errors.
+//
+// Codes have the form Neo.<Classification>.<Category>.<Title>, e.g.
+// Neo.ClientError.Statement.SyntaxError. Servers from 5.7 also report a GQL
+// status and may chain the errors causing the failure.
+type Neo4jError struct {
+	Code    string
+	Message string
+
+	// GQLStatus is the GQLSTATUS code of the error, e.g. 42001. It is empty
+	// for servers predating GQL errors.
+	GQLStatus            string
+	GQLStatusDescription string
+	DiagnosticRecord     packstream.Dictionary
+
+	// Cause is the error causing this one, if reported by the server.
+	Cause *Neo4jError
+}
+
+func newNeo4jError(metadata packstream.Dictionary) *Neo4jError {
+	e := &Neo4jError{}
+
+	// Servers with GQL errors send the Neo4j code as neo4j_code.
+	if code, ok := metadata["neo4j_code"].(string); ok {
+		e.Code = code
+	} else {
+		e.Code, _ = metadata["code"].(string)
+	}
+
+	e.Message, _ = metadata["message"].(string)
+	e.GQLStatus, _ = metadata["gql_status"].(string)
+	e.GQLStatusDescription, _ = metadata["description"].(string)
+	e.DiagnosticRecord, _ = metadata["diagnostic_record"].(packstream.Dictionary)
+
+	if cause, ok := metadata["cause"].(packstream.Dictionary); ok {
+		e.Cause = newNeo4jError(cause)
+	}
+
+	return e
+}
+
+func (e *Neo4jError) Error() string {
+	return fmt.Sprintf("Neo4jError: %s (%s)", e.Code, e.Message)
+}
+
+// Unwrap returns the cause of e, if any.
+func (e *Neo4jError) Unwrap() error {
+	if e.Cause == nil {
+		return nil
+	}
+
+	return e.Cause
+}
+
+// Is reports whether target is a *Neo4jError with the same code, so that
+// errors.Is(err, &Neo4jError{Code: "Neo.ClientError.Security.Unauthorized"})
+// can be used to test for specific errors.
+func (e *Neo4jError) Is(target error) bool {
+	t, ok := target.(*Neo4jError)
+	return ok && t.Code != "" && t.Code == e.Code
+}
+
+// Classification returns the classification of e. Errors caused by the
+// client terminating a transaction are classified as client errors even
+// though their codes name them transient.
+func (e *Neo4jError) Classification() Classification {
+	switch e.Code {
+	case "Neo.TransientError.Transaction.Terminated",
+		"Neo.TransientError.Transaction.LockClientStopped":
+		return ClientError
+	}
+
+	return Classification(e.part(1))
+}
+
+// Category returns the category of e, e.g. Statement or Security.
+func (e *Neo4jError) Category() string {
+	return e.part(2)
+}
+
+// Title returns the title of e, e.g. SyntaxError.
+func (e *Neo4jError) Title() string {
+	return e.part(3)
+}
+
+// part returns the i-th dot separated part of the code.
+func (e *Neo4jError) part(i int) string {
+	parts := strings.SplitN(e.Code, ".", 4)
+	if i >= len(parts) {
+		return ""
+	}
+
+	return parts[i]
+}
+
+// IsTransient reports whether err is a Neo4jError that is transient, so the
+// failed work may succeed if retried.
+func IsTransient(err error) bool {
+	var e *Neo4jError
+	return errors.As(err, &e) && e.Classification() == TransientError
+}
+
+// IsAuthError reports whether err is a Neo4jError caused by invalid or
+// expired credentials.
+func IsAuthError(err error) bool {
+	var e *Neo4jError
+	if !errors.As(err, &e) {
+		return false
+	}
+
+	switch e.Code {
+	case "Neo.ClientError.Security.Unauthorized",
+		"Neo.ClientError.Security.AuthenticationRateLimit",
+		"Neo.ClientError.Security.CredentialsExpired",
+		"Neo.ClientError.Security.TokenExpired",
+		"Neo.ClientError.Security.AuthorizationExpired":
+		return true
+	}
+
+	return false
+}
+
+// IsConstraintViolation reports whether err is a Neo4jError caused by a
+// write violating a schema constraint.
+func IsConstraintViolation(err error) bool {
+	var e *Neo4jError
+	if !errors.As(err, &e) {
+		return false
+	}
+
+	switch e.Code {
+	case "Neo.ClientError.Schema.ConstraintValidationFailed",
+		"Neo.ClientError.Statement.ConstraintVerificationFailed":
+		return true
+	}
+
+	return false
+}
+
+// StateError is returned when a request is not allowed in the current state
+// of a connection. No bytes are sent to the server in that case.
+type StateError struct {
+	Request string
+	State   State
+}
+
+func (e *StateError) Error() string {
+	return fmt.Sprintf("bolt: cannot send %s in state %s", e.Request, e.State)
+}
@@ -0,0 +1,199 @@
+package bolt
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/mattmeyers/graphdb/packstream"
+)
+
+func TestNewNeo4jError(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata packstream.Dictionary
+		want     *Neo4jError
+	}{
+		{
+			name: "legacy failure",
+			metadata: packstream.Dictionary{
+				"code":    "Neo.ClientError.Statement.SyntaxError",
+				"message": "Invalid input",
+			},
+			want: &Neo4jError{
+				Code:    "Neo.ClientError.Statement.SyntaxError",
+				Message: "Invalid input",
+			},
+		},
+		{
+			name: "GQL failure with cause",
+			metadata: packstream.Dictionary{
+				"neo4j_code":        "Neo.ClientError.Statement.SyntaxError",
+				"message":           "Invalid input",
+				"gql_status":        "42001",
+				"description":       "error: syntax error or access rule violation - invalid syntax",
+				"diagnostic_record": packstream.Dictionary{"OPERATION": ""},
+				"cause": packstream.Dictionary{
+					"neo4j_code": "Neo.ClientError.Statement.SyntaxError",
+					"message":    "Invalid input 'RETRUN'",
+					"gql_status": "42I06",
+				},
+			},
+			want: &Neo4jError{
+				Code:                 "Neo.ClientError.Statement.SyntaxError",
+				Message:              "Invalid input",
+				GQLStatus:            "42001",
+				GQLStatusDescription: "error: syntax error or access rule violation - invalid syntax",
+				DiagnosticRecord:     packstream.Dictionary{"OPERATION": ""},
+				Cause: &Neo4jError{
+					Code:      "Neo.ClientError.Statement.SyntaxError",
+					Message:   "Invalid input 'RETRUN'",
+					GQLStatus: "42I06",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newNeo4jError(tt.metadata); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("newNeo4jError() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNeo4jError_parts(t *testing.T) {
+	tests := []struct {
+		name               string
+		code               string
+		wantClassification Classification
+		wantCategory       string
+		wantTitle          string
+	}{
+		{
+			name:               "client error",
+			code:               "Neo.ClientError.Statement.SyntaxError",
+			wantClassification: ClientError,
+			wantCategory:       "Statement",
+			wantTitle:          "SyntaxError",
+		},
+		{
+			name:               "transient error",
+			code:               "Neo.TransientError.Transaction.DeadlockDetected",
+			wantClassification: TransientError,
+			wantCategory:       "Transaction",
+			wantTitle:          "DeadlockDetected",
+		},
+		{
+			name:               "terminated transaction",
+			code:               "Neo.TransientError.Transaction.Terminated",
+			wantClassification: ClientError,
+			wantCategory:       "Transaction",
+			wantTitle:          "Terminated",
+		},
+		{
+			name:               "database error",
+			code:               "Neo.DatabaseError.General.UnknownError",
+			wantClassification: DatabaseError,
+			wantCategory:       "General",
+			wantTitle:          "UnknownError",
+		},
+		{
+			name:               "malformed code",
+			code:               "Neo.ClientError",
+			wantClassification: ClientError,
+			wantCategory:       "",
+			wantTitle:          "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Neo4jError{Code: tt.code}
+			if got := e.Classification(); got != tt.wantClassification {
+				t.Errorf("Neo4jError.Classification() = %v, want %v", got, tt.wantClassification)
+			}
+			if got := e.Category(); got != tt.wantCategory {
+				t.Errorf("Neo4jError.Category() = %v, want %v", got, tt.wantCategory)
+			}
+			if got := e.Title(); got != tt.wantTitle {
+				t.Errorf("Neo4jError.Title() = %v, want %v", got, tt.wantTitle)
+			}
+		})
+	}
+}
+
+func TestNeo4jError_Is(t *testing.T) {
+	cause := &Neo4jError{Code: "Neo.ClientError.Schema.ConstraintValidationFailed"}
+	err := fmt.Errorf("create failed: %w", &Neo4jError{Code: "Neo.ClientError.Statement.ExecutionFailed", Cause: cause})
+
+	if !errors.Is(err, &Neo4jError{Code: "Neo.ClientError.Statement.ExecutionFailed"}) {
+		t.Errorf("errors.Is() = false for the error's code")
+	}
+	if !errors.Is(err, &Neo4jError{Code: cause.Code}) {
+		t.Errorf("errors.Is() = false for the cause's code")
+	}
+	if errors.Is(err, &Neo4jError{Code: "Neo.ClientError.Statement.SyntaxError"}) {
+		t.Errorf("errors.Is() = true for another code")
+	}
+	if errors.Is(err, &Neo4jError{}) {
+		t.Errorf("errors.Is() = true for an empty code")
+	}
+}
+
+func TestIsHelpers(t *testing.T) {
+	tests := []struct {
+		name                    string
+		err                     error
+		wantTransient           bool
+		wantAuthError           bool
+		wantConstraintViolation bool
+	}{
+		{
+			name:          "deadlock",
+			err:           &Neo4jError{Code: "Neo.TransientError.Transaction.DeadlockDetected"},
+			wantTransient: true,
+		},
+		{
+			name:          "terminated",
+			err:           &Neo4jError{Code: "Neo.TransientError.Transaction.Terminated"},
+			wantTransient: false,
+		},
+		{
+			name:          "unauthorized",
+			err:           &Neo4jError{Code: "Neo.ClientError.Security.Unauthorized"},
+			wantAuthError: true,
+		},
+		{
+			name:          "wrapped token expired",
+			err:           fmt.Errorf("hello: %w", &Neo4jError{Code: "Neo.ClientError.Security.TokenExpired"}),
+			wantAuthError: true,
+		},
+		{
+			name:                    "constraint validation",
+			err:                     &Neo4jError{Code: "Neo.ClientError.Schema.ConstraintValidationFailed"},
+			wantConstraintViolation: true,
+		},
+		{
+			name: "forbidden",
+			err:  &Neo4jError{Code: "Neo.ClientError.Security.Forbidden"},
+		},
+		{
+			name: "not a Neo4jError",
+			err:  errors.New("TransientError"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransient(tt.err); got != tt.wantTransient {
+				t.Errorf("IsTransient() = %v, want %v", got, tt.wantTransient)
+			}
+			if got := IsAuthError(tt.err); got != tt.wantAuthError {
+				t.Errorf("IsAuthError() = %v, want %v", got, tt.wantAuthError)
+			}
+			if got := IsConstraintViolation(tt.err); got != tt.wantConstraintViolation {
+				t.Errorf("IsConstraintViolation() = %v, want %v", got, tt.wantConstraintViolation)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package bolt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// magic is the preamble identifying a Bolt connection.
+var magic = [4]byte{0x60, 0x60, 0xB0, 0x17}
+
+// ErrNoCompatibleVersion is returned by Handshake and Negotiate when the
+// client and server have no protocol version in common.
+var ErrNoCompatibleVersion = errors.New("bolt: no compatible protocol version")
+
+// Version is a Bolt protocol version.
+type Version struct {
+	Major uint8
+	Minor uint8
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// Before reports whether v is an earlier version than o.
+func (v Version) Before(o Version) bool {
+	return v.Major < o.Major || (v.Major == o.Major && v.Minor < o.Minor)
+}
+
+// UTCDateTime reports whether v uses the UTC based DateTime structures.
+func (v Version) UTCDateTime() bool {
+	return v.Major >= 5
+}
+
+// ElementIDs reports whether v uses the graph structures with element IDs.
+func (v Version) ElementIDs() bool {
+	return v.Major >= 5
+}
+
+// VersionRange proposes Version together with the Back minor versions
+// preceding it, e.g. 5.4 with Back 4 covers 5.4 down to 5.0.
+type VersionRange struct {
+	Version
+	Back uint8
+}
+
+// contains reports whether v falls within r.
+func (r VersionRange) contains(v Version) bool {
+	return v.Major == r.Major && v.Minor <= r.Minor && int(v.Minor) >= int(r.Minor)-int(r.Back)
+}
+
+// DefaultVersions are the versions proposed by a client during the handshake,
+// in order of preference.
+var DefaultVersions = []VersionRange{
+	{Version: Version{Major: 5, Minor: 4}, Back: 4},
+	{Version: Version{Major: 4, Minor: 4}},
+}
+
+// SupportedVersions are the versions a server built with this package can
+// accept, in order of preference.
+var SupportedVersions = []Version{
+	{Major: 5, Minor: 4},
+	{Major: 5, Minor: 3},
+	{Major: 5, Minor: 2},
+	{Major: 5, Minor: 1},
+	{Major: 5, Minor: 0},
+	{Major: 4, Minor: 4},
+}
+
+// Handshake performs the client side of the Bolt handshake over rw. It sends
+// the magic preamble followed by up to four proposed version ranges and
+// returns the version chosen by the server. DefaultVersions are proposed if
+// none are given.
+func Handshake(rw io.ReadWriter, proposals ...VersionRange) (Version, error) {
+	if len(proposals) == 0 {
+		proposals = DefaultVersions
+	}
+	if len(proposals) > 4 {
+		return Version{}, errors.New("bolt: cannot propose more than 4 versions")
+	}
+
+	var buf [20]byte
+	copy(buf[:4], magic[:])
+	for i, p := range proposals {
+		copy(buf[4+i*4:], []byte{0x00, p.Back, p.Minor, p.Major})
+	}
+
+	if _, err := rw.Write(buf[:]); err != nil {
+		return Version{}, err
+	}
+
+	if _, err := io.ReadFull(rw, buf[:4]); err != nil {
+		return Version{}, err
+	}
+
+	v := Version{Major: buf[3], Minor: buf[2]}
+	if v == (Version{}) {
+		return Version{}, ErrNoCompatibleVersion
+	}
+
+	for _, p := range proposals {
+		if p.contains(v) {
+			return v, nil
+		}
+	}
+
+	return Version{}, fmt.Errorf("bolt: server chose version %s which was not proposed", v)
+}
+
+// Negotiate performs the server side of the Bolt handshake over rw. It reads
+// the client's proposals and responds with the first proposed version found
+// in supported, preferring the highest minor version within each range. If
+// there is none, the client is told so and ErrNoCompatibleVersion returned.
+func Negotiate(rw io.ReadWriter, supported []Version) (Version, error) {
+	var buf [20]byte
+	if _, err := io.ReadFull(rw, buf[:]); err != nil {
+		return Version{}, err
+	}
+
+	if [4]byte{buf[0], buf[1], buf[2], buf[3]} != magic {
+		return Version{}, fmt.Errorf("bolt: invalid handshake preamble %x", buf[:4])
+	}
+
+	var chosen Version
+	for i := 4; i < len(buf) && chosen == (Version{}); i += 4 {
+		p := VersionRange{Version: Version{Major: buf[i+3], Minor: buf[i+2]}, Back: buf[i+1]}
+		if p.Version == (Version{}) {
+			continue
+		}
+
+		for minor := int(p.Minor); minor >= int(p.Minor)-int(p.Back) && minor >= 0; minor-- {
+			if v := (Version{Major: p.Major, Minor: uint8(minor)}); supports(supported, v) {
+				chosen = v
+				break
+			}
+		}
+	}
+
+	if _, err := rw.Write([]byte{0x00, 0x00, chosen.Minor, chosen.Major}); err != nil {
+		return Version{}, err
+	}
+
+	if chosen == (Version{}) {
+		return Version{}, ErrNoCompatibleVersion
+	}
+
+	return chosen, nil
+}
+
+func supports(versions []Version, v Version) bool {
+	for _, s := range versions {
+		if s == v {
+			return true
+		}
+	}
+
+	return false
+}
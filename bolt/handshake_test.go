@@ -0,0 +1,129 @@
+package bolt
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestHandshake(t *testing.T) {
+	tests := []struct {
+		name      string
+		proposals []VersionRange
+		supported []Version
+		want      Version
+		wantErr   error
+	}{
+		{
+			name:      "default versions",
+			proposals: nil,
+			supported: SupportedVersions,
+			want:      Version{Major: 5, Minor: 4},
+			wantErr:   nil,
+		},
+		{
+			name:      "range picks highest supported minor",
+			proposals: []VersionRange{{Version: Version{Major: 5, Minor: 4}, Back: 4}},
+			supported: []Version{{Major: 5, Minor: 1}, {Major: 5, Minor: 2}},
+			want:      Version{Major: 5, Minor: 2},
+			wantErr:   nil,
+		},
+		{
+			name: "falls back to later proposal",
+			proposals: []VersionRange{
+				{Version: Version{Major: 6, Minor: 0}},
+				{Version: Version{Major: 5, Minor: 4}, Back: 2},
+				{Version: Version{Major: 4, Minor: 4}},
+			},
+			supported: []Version{{Major: 4, Minor: 4}},
+			want:      Version{Major: 4, Minor: 4},
+			wantErr:   nil,
+		},
+		{
+			name:      "range excludes older minors",
+			proposals: []VersionRange{{Version: Version{Major: 5, Minor: 4}, Back: 1}},
+			supported: []Version{{Major: 5, Minor: 2}},
+			want:      Version{},
+			wantErr:   ErrNoCompatibleVersion,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+
+			type result struct {
+				v   Version
+				err error
+			}
+			done := make(chan result, 1)
+			go func() {
+				defer server.Close()
+				v, err := Negotiate(server, tt.supported)
+				done <- result{v, err}
+			}()
+
+			got, err := Handshake(client, tt.proposals...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Handshake() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Handshake() = %v, want %v", got, tt.want)
+			}
+
+			if r := <-done; r.v != tt.want || !errors.Is(r.err, tt.wantErr) {
+				t.Errorf("Negotiate() = %v, %v, want %v, %v", r.v, r.err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHandshake_wire(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	go func() {
+		defer server.Close()
+
+		buf := make([]byte, 20)
+		if _, err := io.ReadFull(server, buf); err != nil {
+			return
+		}
+
+		want := []byte{
+			0x60, 0x60, 0xB0, 0x17,
+			0x00, 0x04, 0x04, 0x05,
+			0x00, 0x00, 0x04, 0x04,
+			0x00, 0x00, 0x00, 0x00,
+			0x00, 0x00, 0x00, 0x00,
+		}
+		for i := range want {
+			if buf[i] != want[i] {
+				t.Errorf("Handshake() sent %x, want %x", buf, want)
+				break
+			}
+		}
+
+		// Respond with a version that was not proposed.
+		server.Write([]byte{0x00, 0x00, 0x03, 0x04})
+	}()
+
+	if _, err := Handshake(client); err == nil {
+		t.Error("Handshake() expected error for unproposed version")
+	}
+}
+
+func TestNegotiate_badPreamble(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	go func() {
+		client.Write(make([]byte, 20))
+		client.Close()
+	}()
+
+	if _, err := Negotiate(server, SupportedVersions); err == nil {
+		t.Error("Negotiate() expected error for invalid preamble")
+	}
+}
@@ -0,0 +1,514 @@
+// Package bolt implements the Bolt protocol used by Neo4j on top of the
+// packstream value encoding.
+package bolt
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/mattmeyers/graphdb/packstream"
+)
+
+// Message is a Bolt request or response message. Every message is a
+// packstream structure.
+type Message interface {
+	packstream.Structure
+	packstream.Marshaller
+
+	// fields returns the fields of the message in encoding order.
+	fields() packstream.List
+}
+
+// Encode encodes m for a connection using protocol version v. Unlike
+// MarshalPackstream, values contained in the message are encoded the way v
+// expects, e.g. DateTime values use the UTC based structures and graph
+// structures carry element IDs from Bolt 5.0.
+func Encode(m Message, v Version) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	enc := packstream.NewEncoder(buf)
+	enc.SetUTCDateTime(v.UTCDateTime())
+	enc.SetElementIDs(v.ElementIDs())
+
+	if err := enc.Encode(packstream.RawStructure{Signature: m.Tag(), Fields: m.fields()}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decode decodes a single message. The returned value holds the concrete
+// message type, e.g. Success or Record.
+func Decode(data []byte) (Message, error) {
+	var raw packstream.RawStructure
+	if err := packstream.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	var m decodableMessage
+
+	switch raw.Signature {
+	case Hello{}.Tag():
+		m = new(Hello)
+	case Goodbye{}.Tag():
+		m = new(Goodbye)
+	case Reset{}.Tag():
+		m = new(Reset)
+	case Run{}.Tag():
+		m = new(Run)
+	case Begin{}.Tag():
+		m = new(Begin)
+	case Commit{}.Tag():
+		m = new(Commit)
+	case Rollback{}.Tag():
+		m = new(Rollback)
+	case Discard{}.Tag():
+		m = new(Discard)
+	case Pull{}.Tag():
+		m = new(Pull)
+	case Route{}.Tag():
+		m = new(Route)
+	case Logon{}.Tag():
+		m = new(Logon)
+	case Logoff{}.Tag():
+		m = new(Logoff)
+	case Success{}.Tag():
+		m = new(Success)
+	case Record{}.Tag():
+		m = new(Record)
+	case Ignored{}.Tag():
+		m = new(Ignored)
+	case Failure{}.Tag():
+		m = new(Failure)
+	default:
+		return nil, fmt.Errorf("unknown message tag 0x%02X", raw.Signature)
+	}
+
+	if err := m.setFields(raw.Fields); err != nil {
+		return nil, err
+	}
+
+	// Messages are returned by value to match how they are encoded.
+	return reflect.ValueOf(m).Elem().Interface().(Message), nil
+}
+
+// decodableMessage is implemented by pointers to messages.
+type decodableMessage interface {
+	Message
+
+	// setFields stores the decoded fields of the message.
+	setFields(fields packstream.List) error
+}
+
+// Hello initializes a connection. Extra carries the user_agent, routing
+// context and, before Bolt 5.1, the authentication token.
+type Hello struct {
+	Extra packstream.Dictionary
+}
+
+func (Hello) Tag() byte        { return 0x01 }
+func (Hello) FieldCount() uint { return 1 }
+
+func (m Hello) MarshalPackstream() ([]byte, error) {
+	return marshalMessage(m)
+}
+
+func (m Hello) fields() packstream.List {
+	return packstream.List{m.Extra}
+}
+
+func (m *Hello) UnmarshalPackstream(data []byte) error {
+	return unmarshalMessage(data, m)
+}
+
+func (m *Hello) setFields(fields packstream.List) error {
+	return assignFields(m, fields, &m.Extra)
+}
+
+// Goodbye announces that the client is closing the connection.
+type Goodbye struct{}
+
+func (Goodbye) Tag() byte        { return 0x02 }
+func (Goodbye) FieldCount() uint { return 0 }
+
+func (m Goodbye) MarshalPackstream() ([]byte, error) {
+	return marshalMessage(m)
+}
+
+func (Goodbye) fields() packstream.List { return nil }
+
+func (m *Goodbye) UnmarshalPackstream(data []byte) error {
+	return unmarshalMessage(data, m)
+}
+
+func (m *Goodbye) setFields(fields packstream.List) error {
+	return assignFields(m, fields)
+}
+
+// Reset interrupts the current work and returns the connection to READY.
+type Reset struct{}
+
+func (Reset) Tag() byte        { return 0x0F }
+func (Reset) FieldCount() uint { return 0 }
+
+func (m Reset) MarshalPackstream() ([]byte, error) {
+	return marshalMessage(m)
+}
+
+func (Reset) fields() packstream.List { return nil }
+
+func (m *Reset) UnmarshalPackstream(data []byte) error {
+	return unmarshalMessage(data, m)
+}
+
+func (m *Reset) setFields(fields packstream.List) error {
+	return assignFields(m, fields)
+}
+
+// Run submits a query for execution.
+type Run struct {
+	Query      string
+	Parameters packstream.Dictionary
+	Extra      packstream.Dictionary
+}
+
+func (Run) Tag() byte        { return 0x10 }
+func (Run) FieldCount() uint { return 3 }
+
+func (m Run) MarshalPackstream() ([]byte, error) {
+	return marshalMessage(m)
+}
+
+func (m Run) fields() packstream.List {
+	return packstream.List{m.Query, m.Parameters, m.Extra}
+}
+
+func (m *Run) UnmarshalPackstream(data []byte) error {
+	return unmarshalMessage(data, m)
+}
+
+func (m *Run) setFields(fields packstream.List) error {
+	return assignFields(m, fields, &m.Query, &m.Parameters, &m.Extra)
+}
+
+// Begin starts an explicit transaction.
+type Begin struct {
+	Extra packstream.Dictionary
+}
+
+func (Begin) Tag() byte        { return 0x11 }
+func (Begin) FieldCount() uint { return 1 }
+
+func (m Begin) MarshalPackstream() ([]byte, error) {
+	return marshalMessage(m)
+}
+
+func (m Begin) fields() packstream.List {
+	return packstream.List{m.Extra}
+}
+
+func (m *Begin) UnmarshalPackstream(data []byte) error {
+	return unmarshalMessage(data, m)
+}
+
+func (m *Begin) setFields(fields packstream.List) error {
+	return assignFields(m, fields, &m.Extra)
+}
+
+// Commit commits the current explicit transaction.
+type Commit struct{}
+
+func (Commit) Tag() byte        { return 0x12 }
+func (Commit) FieldCount() uint { return 0 }
+
+func (m Commit) MarshalPackstream() ([]byte, error) {
+	return marshalMessage(m)
+}
+
+func (Commit) fields() packstream.List { return nil }
+
+func (m *Commit) UnmarshalPackstream(data []byte) error {
+	return unmarshalMessage(data, m)
+}
+
+func (m *Commit) setFields(fields packstream.List) error {
+	return assignFields(m, fields)
+}
+
+// Rollback rolls back the current explicit transaction.
+type Rollback struct{}
+
+func (Rollback) Tag() byte        { return 0x13 }
+func (Rollback) FieldCount() uint { return 0 }
+
+func (m Rollback) MarshalPackstream() ([]byte, error) {
+	return marshalMessage(m)
+}
+
+func (Rollback) fields() packstream.List { return nil }
+
+func (m *Rollback) UnmarshalPackstream(data []byte) error {
+	return unmarshalMessage(data, m)
+}
+
+func (m *Rollback) setFields(fields packstream.List) error {
+	return assignFields(m, fields)
+}
+
+// Discard drops records of a result. Extra holds n and qid.
+type Discard struct {
+	Extra packstream.Dictionary
+}
+
+func (Discard) Tag() byte        { return 0x2F }
+func (Discard) FieldCount() uint { return 1 }
+
+func (m Discard) MarshalPackstream() ([]byte, error) {
+	return marshalMessage(m)
+}
+
+func (m Discard) fields() packstream.List {
+	return packstream.List{m.Extra}
+}
+
+func (m *Discard) UnmarshalPackstream(data []byte) error {
+	return unmarshalMessage(data, m)
+}
+
+func (m *Discard) setFields(fields packstream.List) error {
+	return assignFields(m, fields, &m.Extra)
+}
+
+// Pull streams records of a result. Extra holds n and qid.
+type Pull struct {
+	Extra packstream.Dictionary
+}
+
+func (Pull) Tag() byte        { return 0x3F }
+func (Pull) FieldCount() uint { return 1 }
+
+func (m Pull) MarshalPackstream() ([]byte, error) {
+	return marshalMessage(m)
+}
+
+func (m Pull) fields() packstream.List {
+	return packstream.List{m.Extra}
+}
+
+func (m *Pull) UnmarshalPackstream(data []byte) error {
+	return unmarshalMessage(data, m)
+}
+
+func (m *Pull) setFields(fields packstream.List) error {
+	return assignFields(m, fields, &m.Extra)
+}
+
+// Route requests the routing table of a database.
+type Route struct {
+	Routing   packstream.Dictionary
+	Bookmarks packstream.List
+	Extra     packstream.Dictionary
+}
+
+func (Route) Tag() byte        { return 0x66 }
+func (Route) FieldCount() uint { return 3 }
+
+func (m Route) MarshalPackstream() ([]byte, error) {
+	return marshalMessage(m)
+}
+
+func (m Route) fields() packstream.List {
+	return packstream.List{m.Routing, m.Bookmarks, m.Extra}
+}
+
+func (m *Route) UnmarshalPackstream(data []byte) error {
+	return unmarshalMessage(data, m)
+}
+
+func (m *Route) setFields(fields packstream.List) error {
+	return assignFields(m, fields, &m.Routing, &m.Bookmarks, &m.Extra)
+}
+
+// Logon authenticates the connection from Bolt 5.1 on.
+type Logon struct {
+	Auth packstream.Dictionary
+}
+
+func (Logon) Tag() byte        { return 0x6A }
+func (Logon) FieldCount() uint { return 1 }
+
+func (m Logon) MarshalPackstream() ([]byte, error) {
+	return marshalMessage(m)
+}
+
+func (m Logon) fields() packstream.List {
+	return packstream.List{m.Auth}
+}
+
+func (m *Logon) UnmarshalPackstream(data []byte) error {
+	return unmarshalMessage(data, m)
+}
+
+func (m *Logon) setFields(fields packstream.List) error {
+	return assignFields(m, fields, &m.Auth)
+}
+
+// Logoff deauthenticates the connection from Bolt 5.1 on.
+type Logoff struct{}
+
+func (Logoff) Tag() byte        { return 0x6B }
+func (Logoff) FieldCount() uint { return 0 }
+
+func (m Logoff) MarshalPackstream() ([]byte, error) {
+	return marshalMessage(m)
+}
+
+func (Logoff) fields() packstream.List { return nil }
+
+func (m *Logoff) UnmarshalPackstream(data []byte) error {
+	return unmarshalMessage(data, m)
+}
+
+func (m *Logoff) setFields(fields packstream.List) error {
+	return assignFields(m, fields)
+}
+
+// Success is the summary response to a request that succeeded.
+type Success struct {
+	Metadata packstream.Dictionary
+}
+
+func (Success) Tag() byte        { return 0x70 }
+func (Success) FieldCount() uint { return 1 }
+
+func (m Success) MarshalPackstream() ([]byte, error) {
+	return marshalMessage(m)
+}
+
+func (m Success) fields() packstream.List {
+	return packstream.List{m.Metadata}
+}
+
+func (m *Success) UnmarshalPackstream(data []byte) error {
+	return unmarshalMessage(data, m)
+}
+
+func (m *Success) setFields(fields packstream.List) error {
+	return assignFields(m, fields, &m.Metadata)
+}
+
+// Record carries the values of one record of a result.
+type Record struct {
+	Data packstream.List
+}
+
+func (Record) Tag() byte        { return 0x71 }
+func (Record) FieldCount() uint { return 1 }
+
+func (m Record) MarshalPackstream() ([]byte, error) {
+	return marshalMessage(m)
+}
+
+func (m Record) fields() packstream.List {
+	return packstream.List{m.Data}
+}
+
+func (m *Record) UnmarshalPackstream(data []byte) error {
+	return unmarshalMessage(data, m)
+}
+
+func (m *Record) setFields(fields packstream.List) error {
+	return assignFields(m, fields, &m.Data)
+}
+
+// Ignored is the response to requests sent while the connection is FAILED
+// or INTERRUPTED.
+type Ignored struct{}
+
+func (Ignored) Tag() byte        { return 0x7E }
+func (Ignored) FieldCount() uint { return 0 }
+
+func (m Ignored) MarshalPackstream() ([]byte, error) {
+	return marshalMessage(m)
+}
+
+func (Ignored) fields() packstream.List { return nil }
+
+func (m *Ignored) UnmarshalPackstream(data []byte) error {
+	return unmarshalMessage(data, m)
+}
+
+func (m *Ignored) setFields(fields packstream.List) error {
+	return assignFields(m, fields)
+}
+
+// Failure is the summary response to a request that failed. Metadata holds
+// the code and message of the error.
+type Failure struct {
+	Metadata packstream.Dictionary
+}
+
+func (Failure) Tag() byte        { return 0x7F }
+func (Failure) FieldCount() uint { return 1 }
+
+func (m Failure) MarshalPackstream() ([]byte, error) {
+	return marshalMessage(m)
+}
+
+func (m Failure) fields() packstream.List {
+	return packstream.List{m.Metadata}
+}
+
+func (m *Failure) UnmarshalPackstream(data []byte) error {
+	return unmarshalMessage(data, m)
+}
+
+func (m *Failure) setFields(fields packstream.List) error {
+	return assignFields(m, fields, &m.Metadata)
+}
+
+func marshalMessage(m Message) ([]byte, error) {
+	return packstream.Marshal(packstream.RawStructure{Signature: m.Tag(), Fields: m.fields()})
+}
+
+// unmarshalMessage decodes data into m after checking its tag.
+func unmarshalMessage(data []byte, m decodableMessage) error {
+	var raw packstream.RawStructure
+	if err := packstream.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	if raw.Signature != m.Tag() {
+		return fmt.Errorf("cannot unmarshal message with tag 0x%02X into %T", raw.Signature, m)
+	}
+
+	return m.setFields(raw.Fields)
+}
+
+// assignFields stores fields in the field pointers of m, in encoding order,
+// after checking the number of fields.
+func assignFields(m Message, fields packstream.List, ptrs ...interface{}) error {
+	if len(fields) != len(ptrs) {
+		return fmt.Errorf("message with tag 0x%02X has %d fields, expected %d", m.Tag(), len(fields), len(ptrs))
+	}
+
+	for i, f := range ptrs {
+		var ok bool
+
+		switch p := f.(type) {
+		case *string:
+			*p, ok = fields[i].(string)
+		case *packstream.Dictionary:
+			*p, ok = fields[i].(packstream.Dictionary)
+		case *packstream.List:
+			*p, ok = fields[i].(packstream.List)
+		}
+
+		if !ok {
+			return fmt.Errorf("cannot unmarshal field %d of type %T in message with tag 0x%02X", i, fields[i], m.Tag())
+		}
+	}
+
+	return nil
+}
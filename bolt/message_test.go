@@ -0,0 +1,243 @@
+package bolt
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/mattmeyers/graphdb/packstream"
+)
+
+// The byte vectors below follow the examples of the Bolt protocol
+// specification.
+func TestMessage_MarshalPackstream(t *testing.T) {
+	tests := []struct {
+		name string
+		m    Message
+		want []byte
+	}{
+		{
+			name: "hello",
+			m:    Hello{Extra: packstream.Dictionary{"user_agent": "Example/4.1.0"}},
+			want: []byte{
+				0xB1, 0x01, 0xA1, 0x8A, 0x75, 0x73, 0x65, 0x72, 0x5F, 0x61, 0x67, 0x65, 0x6E, 0x74,
+				0x8D, 0x45, 0x78, 0x61, 0x6D, 0x70, 0x6C, 0x65, 0x2F, 0x34, 0x2E, 0x31, 0x2E, 0x30,
+			},
+		},
+		{
+			name: "goodbye",
+			m:    Goodbye{},
+			want: []byte{0xB0, 0x02},
+		},
+		{
+			name: "reset",
+			m:    Reset{},
+			want: []byte{0xB0, 0x0F},
+		},
+		{
+			name: "run",
+			m:    Run{Query: "RETURN 1 AS num", Parameters: packstream.Dictionary{}, Extra: packstream.Dictionary{}},
+			want: []byte{
+				0xB3, 0x10, 0x8F, 0x52, 0x45, 0x54, 0x55, 0x52, 0x4E, 0x20, 0x31, 0x20, 0x41, 0x53,
+				0x20, 0x6E, 0x75, 0x6D, 0xA0, 0xA0,
+			},
+		},
+		{
+			name: "begin",
+			m:    Begin{},
+			want: []byte{0xB1, 0x11, 0xA0},
+		},
+		{
+			name: "commit",
+			m:    Commit{},
+			want: []byte{0xB0, 0x12},
+		},
+		{
+			name: "rollback",
+			m:    Rollback{},
+			want: []byte{0xB0, 0x13},
+		},
+		{
+			name: "discard",
+			m:    Discard{Extra: packstream.Dictionary{"n": -1}},
+			want: []byte{0xB1, 0x2F, 0xA1, 0x81, 0x6E, 0xFF},
+		},
+		{
+			name: "pull",
+			m:    Pull{Extra: packstream.Dictionary{"n": -1}},
+			want: []byte{0xB1, 0x3F, 0xA1, 0x81, 0x6E, 0xFF},
+		},
+		{
+			name: "route",
+			m:    Route{Routing: packstream.Dictionary{"address": "x:7687"}, Bookmarks: packstream.List{}, Extra: packstream.Dictionary{}},
+			want: []byte{
+				0xB3, 0x66, 0xA1, 0x87, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x86, 0x78, 0x3A,
+				0x37, 0x36, 0x38, 0x37, 0x90, 0xA0,
+			},
+		},
+		{
+			name: "logon",
+			m:    Logon{Auth: packstream.Dictionary{"scheme": "none"}},
+			want: []byte{0xB1, 0x6A, 0xA1, 0x86, 0x73, 0x63, 0x68, 0x65, 0x6D, 0x65, 0x84, 0x6E, 0x6F, 0x6E, 0x65},
+		},
+		{
+			name: "logoff",
+			m:    Logoff{},
+			want: []byte{0xB0, 0x6B},
+		},
+		{
+			name: "success",
+			m:    Success{Metadata: packstream.Dictionary{"server": "Neo4j/5.0"}},
+			want: []byte{
+				0xB1, 0x70, 0xA1, 0x86, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x89, 0x4E, 0x65, 0x6F,
+				0x34, 0x6A, 0x2F, 0x35, 0x2E, 0x30,
+			},
+		},
+		{
+			name: "record",
+			m:    Record{Data: packstream.List{1, 2, 3}},
+			want: []byte{0xB1, 0x71, 0x93, 0x01, 0x02, 0x03},
+		},
+		{
+			name: "ignored",
+			m:    Ignored{},
+			want: []byte{0xB0, 0x7E},
+		},
+		{
+			name: "failure",
+			m:    Failure{Metadata: packstream.Dictionary{"code": "Neo.ClientError.General.Unknown"}},
+			want: []byte{
+				0xB1, 0x7F, 0xA1, 0x84, 0x63, 0x6F, 0x64, 0x65, 0xD0, 0x1F, 0x4E, 0x65, 0x6F, 0x2E,
+				0x43, 0x6C, 0x69, 0x65, 0x6E, 0x74, 0x45, 0x72, 0x72, 0x6F, 0x72, 0x2E, 0x47, 0x65,
+				0x6E, 0x65, 0x72, 0x61, 0x6C, 0x2E, 0x55, 0x6E, 0x6B, 0x6E, 0x6F, 0x77, 0x6E,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := packstream.Marshal(tt.m)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Marshal() = %x, want %x", got, tt.want)
+			}
+
+			m, err := Decode(tt.want)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+
+			// Round trip through the encoding since integers decode as int64.
+			again, err := packstream.Marshal(m)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if reflect.TypeOf(m) != reflect.TypeOf(tt.m) || !reflect.DeepEqual(again, tt.want) {
+				t.Errorf("Decode() = %#v, want %#v", m, tt.m)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    Message
+		wantErr bool
+	}{
+		{
+			name: "success with fields",
+			data: []byte{
+				0xB1, 0x70, 0xA2, 0x86, 0x66, 0x69, 0x65, 0x6C, 0x64, 0x73, 0x91, 0x83, 0x6E, 0x75,
+				0x6D, 0x87, 0x74, 0x5F, 0x66, 0x69, 0x72, 0x73, 0x74, 0x0C,
+			},
+			want:    Success{Metadata: packstream.Dictionary{"fields": packstream.List{"num"}, "t_first": int64(12)}},
+			wantErr: false,
+		},
+		{
+			name:    "record with node",
+			data:    []byte{0xB1, 0x71, 0x91, 0xB3, 0x4E, 0x01, 0x90, 0xA0},
+			want:    Record{Data: packstream.List{packstream.Node{ID: 1, Labels: packstream.List{}, Properties: packstream.Dictionary{}}}},
+			wantErr: false,
+		},
+		{
+			name:    "route is not a DateTimeZoneID",
+			data:    []byte{0xB3, 0x66, 0xA0, 0x90, 0xA0},
+			want:    Route{Routing: packstream.Dictionary{}, Bookmarks: packstream.List{}, Extra: packstream.Dictionary{}},
+			wantErr: false,
+		},
+		{
+			name:    "unknown tag",
+			data:    []byte{0xB0, 0x55},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "wrong field count",
+			data:    []byte{0xB0, 0x70},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "wrong field type",
+			data:    []byte{0xB1, 0x71, 0xA0},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "too short",
+			data:    []byte{0xB0},
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	run := Run{
+		Query:      "RETURN $t",
+		Parameters: packstream.Dictionary{"t": packstream.DateTime{Seconds: 7_200, TZOffsetSeconds: 3_600}},
+	}
+
+	tests := []struct {
+		name    string
+		version Version
+		want    []byte
+	}{
+		{
+			name:    "legacy date time",
+			version: Version{Major: 4, Minor: 4},
+			want:    []byte{0xB3, 0x46, 0xC9, 0x1C, 0x20, 0x00, 0xC9, 0x0E, 0x10},
+		},
+		{
+			name:    "utc date time",
+			version: Version{Major: 5, Minor: 0},
+			want:    []byte{0xB3, 0x49, 0xC9, 0x0E, 0x10, 0x00, 0xC9, 0x0E, 0x10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Encode(run, tt.version)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if !bytes.Contains(got, tt.want) {
+				t.Errorf("Encode() = %x, want it to contain %x", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package graphdb
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// BookmarkManager shares bookmarks between sessions, so that work in one
+// session observes the writes of another even if they run on different
+// servers of a cluster or in different services. Implementations must be
+// safe for concurrent use.
+type BookmarkManager interface {
+	// GetBookmarks returns the bookmarks to send when starting work.
+	GetBookmarks(ctx context.Context) ([]string, error)
+
+	// UpdateBookmarks replaces the previous bookmarks, which work was started
+	// with, by the bookmarks resulting from the work.
+	UpdateBookmarks(ctx context.Context, previous, current []string) error
+}
+
+// NewBookmarkManager returns a BookmarkManager keeping bookmarks in memory,
+// starting with the given bookmarks.
+func NewBookmarkManager(initial ...string) BookmarkManager {
+	m := &bookmarkManager{bookmarks: make(map[string]struct{})}
+	for _, b := range initial {
+		m.bookmarks[b] = struct{}{}
+	}
+
+	return m
+}
+
+type bookmarkManager struct {
+	mu        sync.Mutex
+	bookmarks map[string]struct{}
+}
+
+func (m *bookmarkManager) GetBookmarks(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bookmarks := make([]string, 0, len(m.bookmarks))
+	for b := range m.bookmarks {
+		bookmarks = append(bookmarks, b)
+	}
+	sort.Strings(bookmarks)
+
+	return bookmarks, nil
+}
+
+func (m *bookmarkManager) UpdateBookmarks(ctx context.Context, previous, current []string) error {
+	if len(current) == 0 {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, b := range previous {
+		delete(m.bookmarks, b)
+	}
+	for _, b := range current {
+		m.bookmarks[b] = struct{}{}
+	}
+
+	return nil
+}
+
+// bookmarks returns the bookmarks to start work with: the session's last
+// bookmarks together with those of its bookmark manager.
+func (s *Session) bookmarks(ctx context.Context) ([]string, error) {
+	if s.config.BookmarkManager == nil {
+		return s.lastBookmarks, nil
+	}
+
+	shared, err := s.config.BookmarkManager.GetBookmarks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{}, len(s.lastBookmarks)+len(shared))
+	var bookmarks []string
+	for _, l := range [][]string{s.lastBookmarks, shared} {
+		for _, b := range l {
+			if _, ok := seen[b]; !ok {
+				seen[b] = struct{}{}
+				bookmarks = append(bookmarks, b)
+			}
+		}
+	}
+
+	return bookmarks, nil
+}
+
+// updateBookmark records the bookmark resulting from work started with the
+// previous bookmarks. Work that did not produce a bookmark, e.g. because it
+// was read only on an older server, leaves the bookmarks unchanged.
+func (s *Session) updateBookmark(ctx context.Context, previous []string, bookmark interface{}) error {
+	b, ok := bookmark.(string)
+	if !ok || b == "" {
+		return nil
+	}
+	s.lastBookmarks = []string{b}
+
+	if s.config.BookmarkManager == nil {
+		return nil
+	}
+
+	return s.config.BookmarkManager.UpdateBookmarks(ctx, previous, s.lastBookmarks)
+}
+
+// LastBookmarks returns the bookmarks of the last work done by the session,
+// or the initial bookmarks if there was none. They can be passed to another
+// session to make it observe the session's writes.
+func (s *Session) LastBookmarks() []string {
+	return s.lastBookmarks
+}
@@ -0,0 +1,191 @@
+package graphdb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/mattmeyers/graphdb/bolt"
+	"github.com/mattmeyers/graphdb/packstream"
+)
+
+func TestBookmarkManager(t *testing.T) {
+	ctx := context.Background()
+	m := NewBookmarkManager("b2", "b1")
+
+	got, err := m.GetBookmarks(ctx)
+	if err != nil {
+		t.Fatalf("BookmarkManager.GetBookmarks() error = %v", err)
+	}
+	if want := []string{"b1", "b2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("BookmarkManager.GetBookmarks() = %v, want %v", got, want)
+	}
+
+	if err := m.UpdateBookmarks(ctx, []string{"b1"}, []string{"b3"}); err != nil {
+		t.Fatalf("BookmarkManager.UpdateBookmarks() error = %v", err)
+	}
+	got, _ = m.GetBookmarks(ctx)
+	if want := []string{"b2", "b3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("BookmarkManager.GetBookmarks() = %v, want %v", got, want)
+	}
+
+	// Work without a new bookmark keeps the previous ones.
+	if err := m.UpdateBookmarks(ctx, []string{"b2", "b3"}, nil); err != nil {
+		t.Fatalf("BookmarkManager.UpdateBookmarks() error = %v", err)
+	}
+	got, _ = m.GetBookmarks(ctx)
+	if want := []string{"b2", "b3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("BookmarkManager.GetBookmarks() = %v, want %v", got, want)
+	}
+}
+
+func TestBookmarkManager_concurrent(t *testing.T) {
+	ctx := context.Background()
+	m := NewBookmarkManager()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			previous, _ := m.GetBookmarks(ctx)
+			m.UpdateBookmarks(ctx, previous, []string{fmt.Sprint(i)})
+		}(i)
+	}
+	wg.Wait()
+
+	if got, _ := m.GetBookmarks(ctx); len(got) == 0 {
+		t.Errorf("BookmarkManager.GetBookmarks() = %v, want at least one bookmark", got)
+	}
+}
+
+// bookmarkServer answers COMMIT and the end of auto-commit results with
+// increasing bookmarks.
+func bookmarkServer() *recorder {
+	var n int
+	return &recorder{next: func(req bolt.Message) []bolt.Message {
+		switch req.(type) {
+		case bolt.Run:
+			return []bolt.Message{bolt.Success{Metadata: packstream.Dictionary{"fields": packstream.List{}}}}
+		case bolt.Pull, bolt.Discard, bolt.Commit:
+			n++
+			return []bolt.Message{bolt.Success{Metadata: packstream.Dictionary{"bookmark": fmt.Sprintf("bm%d", n)}}}
+		}
+		return nil
+	}}
+}
+
+// sentBookmarks returns the bookmarks sent with each BEGIN and each RUN of
+// an "auto" query.
+func sentBookmarks(reqs []bolt.Message) []interface{} {
+	var sent []interface{}
+	for _, req := range reqs {
+		switch req := req.(type) {
+		case bolt.Begin:
+			sent = append(sent, req.Extra["bookmarks"])
+		case bolt.Run:
+			if req.Query == "auto" {
+				sent = append(sent, req.Extra["bookmarks"])
+			}
+		}
+	}
+	return sent
+}
+
+func TestSession_bookmarks(t *testing.T) {
+	ctx := context.Background()
+	rec := bookmarkServer()
+	d := newTestDriver(t, rec.handle)
+
+	s := d.NewSession(SessionConfig{Bookmarks: []string{"initial"}})
+	defer s.Close(ctx)
+
+	tx, err := s.BeginTransaction(ctx)
+	if err != nil {
+		t.Fatalf("Session.BeginTransaction() error = %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatalf("Tx.Commit() error = %v", err)
+	}
+	if want := []string{"bm1"}; !reflect.DeepEqual(s.LastBookmarks(), want) {
+		t.Errorf("Session.LastBookmarks() = %v, want %v", s.LastBookmarks(), want)
+	}
+
+	res, err := s.Run(ctx, "auto", nil)
+	if err != nil {
+		t.Fatalf("Session.Run() error = %v", err)
+	}
+	if _, err := res.Consume(ctx); err != nil {
+		t.Fatalf("Result.Consume() error = %v", err)
+	}
+
+	if _, err := s.BeginTransaction(ctx); err != nil {
+		t.Fatalf("Session.BeginTransaction() error = %v", err)
+	}
+
+	want := []interface{}{
+		packstream.List{"initial"},
+		packstream.List{"bm1"},
+		packstream.List{"bm2"},
+	}
+	if got := sentBookmarks(rec.requests()); !reflect.DeepEqual(got, want) {
+		t.Errorf("sent bookmarks = %v, want %v", got, want)
+	}
+}
+
+func TestSession_bookmarkManager(t *testing.T) {
+	ctx := context.Background()
+	rec := bookmarkServer()
+	d := newTestDriver(t, rec.handle)
+	m := NewBookmarkManager()
+
+	for i := 0; i < 3; i++ {
+		s := d.NewSession(SessionConfig{BookmarkManager: m})
+		if _, err := s.ExecuteWrite(ctx, func(tx *Tx) (interface{}, error) { return nil, nil }); err != nil {
+			t.Fatalf("Session.ExecuteWrite() error = %v", err)
+		}
+		s.Close(ctx)
+	}
+
+	// A session that has seen bm1 still sends it along with the manager's
+	// bookmarks.
+	s := d.NewSession(SessionConfig{BookmarkManager: m, Bookmarks: []string{"bm1"}})
+	defer s.Close(ctx)
+	if _, err := s.BeginTransaction(ctx); err != nil {
+		t.Fatalf("Session.BeginTransaction() error = %v", err)
+	}
+
+	want := []interface{}{
+		nil,
+		packstream.List{"bm1"},
+		packstream.List{"bm2"},
+		packstream.List{"bm1", "bm3"},
+	}
+	if got := sentBookmarks(rec.requests()); !reflect.DeepEqual(got, want) {
+		t.Errorf("sent bookmarks = %v, want %v", got, want)
+	}
+
+	if got, _ := m.GetBookmarks(ctx); !reflect.DeepEqual(got, []string{"bm3"}) {
+		t.Errorf("BookmarkManager.GetBookmarks() = %v, want %v", got, []string{"bm3"})
+	}
+}
+
+func TestDriver_routingBookmarks(t *testing.T) {
+	c := newCluster(t, "a")
+	c.table = func(string) packstream.Dictionary {
+		return c.rt(300, []string{"a"}, []string{"a"})
+	}
+	d := c.driver(t, "")
+
+	if err := run(t, d, SessionConfig{Bookmarks: []string{"bm1"}}, "write"); err != nil {
+		t.Fatalf("run error = %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if want := (packstream.List{"bm1"}); !reflect.DeepEqual(c.routes[0].Bookmarks, want) {
+		t.Errorf("ROUTE bookmarks = %v, want %v", c.routes[0].Bookmarks, want)
+	}
+}
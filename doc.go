@@ -0,0 +1,3 @@
+// Package graphdb is a client for graph databases speaking the Bolt protocol,
+// such as Neo4j and Memgraph.
+package graphdb
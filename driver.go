@@ -0,0 +1,308 @@
+package graphdb
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mattmeyers/graphdb/bolt"
+	"github.com/mattmeyers/graphdb/packstream"
+)
+
+// DefaultPort is the port used when the target of a driver has none.
+const DefaultPort = "7687"
+
+// Defaults of the connection pool settings.
+const (
+	DefaultMaxConnectionPoolSize        = 100
+	DefaultConnectionAcquisitionTimeout = time.Minute
+	DefaultMaxConnectionLifetime        = time.Hour
+)
+
+// Config holds the settings of a Driver.
+type Config struct {
+	// Auth is the auth token connections authenticate with. It defaults to
+	// NoAuth.
+	Auth AuthToken
+
+	// AuthManager, if set, provides the auth token instead of Auth and
+	// allows rotating it.
+	AuthManager AuthTokenManager
+
+	// UserAgent identifies the client to the server.
+	UserAgent string
+
+	// FetchSize is the default number of records pulled per batch. A value
+	// of -1 pulls all records at once.
+	FetchSize int
+
+	// MaxTransactionRetryTime bounds the time spent retrying managed
+	// transactions.
+	MaxTransactionRetryTime time.Duration
+
+	// MaxConnectionPoolSize limits the connections to each server. Zero or
+	// less means no limit.
+	MaxConnectionPoolSize int
+
+	// ConnectionAcquisitionTimeout bounds the time spent waiting for a
+	// connection when the pool is full, including the time to open one.
+	ConnectionAcquisitionTimeout time.Duration
+
+	// MaxConnectionLifetime is the age after which connections are closed
+	// instead of being reused.
+	MaxConnectionLifetime time.Duration
+
+	// IdleLivenessCheck is the idle time after which pooled connections are
+	// checked with a RESET round trip before being reused. Zero disables
+	// the check.
+	IdleLivenessCheck time.Duration
+
+	// Dial opens network connections. It defaults to net.Dialer.DialContext.
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// TLSConfig, if set, encrypts connections with TLS, even for bolt:// and
+	// neo4j:// targets. It is how custom root CAs and client certificates
+	// are provided. The +s and +ssc schemes override its
+	// InsecureSkipVerify field.
+	TLSConfig *tls.Config
+}
+
+// Driver connects to a Bolt server and creates sessions against it. A Driver
+// is safe for concurrent use.
+type Driver struct {
+	addr   string
+	config Config
+	pool   *pool
+	auth   AuthTokenManager
+	retry  retryPolicy
+
+	// tls is set when connections are encrypted.
+	tls *tls.Config
+
+	// router is set for neo4j:// targets.
+	router *router
+}
+
+// NewDriver returns a driver for the server at target. The options are
+// applied to the default configuration in order.
+//
+// A target of the form bolt://host:port connects directly to a single server.
+// A target of the form neo4j://host:port?key=value connects to a cluster,
+// using host as the initial router. Sessions are routed to readers or writers
+// according to their access mode, and the query parameters are passed to the
+// server as the routing context.
+//
+// Either scheme may be suffixed with +s to encrypt connections with TLS and
+// verify the server's certificate, or with +ssc to encrypt connections while
+// accepting any certificate, including self-signed ones.
+func NewDriver(target string, opts ...func(*Config)) (*Driver, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme, security := u.Scheme, ""
+	if i := strings.IndexByte(scheme, '+'); i >= 0 {
+		scheme, security = scheme[:i], scheme[i+1:]
+	}
+	if scheme != "bolt" && scheme != "neo4j" {
+		return nil, fmt.Errorf("graphdb: unsupported URI scheme %q", u.Scheme)
+	}
+	if security != "" && security != "s" && security != "ssc" {
+		return nil, fmt.Errorf("graphdb: unsupported URI scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("graphdb: URI has no host")
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = DefaultPort
+	}
+
+	config := Config{
+		Auth:      NoAuth(),
+		UserAgent: "graphdb",
+		FetchSize: DefaultFetchSize,
+
+		MaxTransactionRetryTime:      DefaultMaxTransactionRetryTime,
+		MaxConnectionPoolSize:        DefaultMaxConnectionPoolSize,
+		ConnectionAcquisitionTimeout: DefaultConnectionAcquisitionTimeout,
+		MaxConnectionLifetime:        DefaultMaxConnectionLifetime,
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	if config.Dial == nil {
+		var d net.Dialer
+		config.Dial = d.DialContext
+	}
+
+	d := &Driver{
+		addr:   net.JoinHostPort(u.Hostname(), port),
+		config: config,
+		retry:  newRetryPolicy(config.MaxTransactionRetryTime),
+	}
+	if config.TLSConfig != nil || security != "" {
+		d.tls = &tls.Config{}
+		if config.TLSConfig != nil {
+			d.tls = config.TLSConfig.Clone()
+		}
+		if security != "" {
+			d.tls.InsecureSkipVerify = security == "ssc"
+		}
+	}
+	d.auth = config.AuthManager
+	if d.auth == nil {
+		d.auth = StaticAuthTokenManager(config.Auth)
+	}
+
+	d.pool = newPool(config, d.connect)
+	d.pool.reauth = d.reauth
+
+	if scheme == "neo4j" {
+		routingContext := packstream.Dictionary{"address": d.addr}
+		for k, v := range u.Query() {
+			routingContext[k] = v[0]
+		}
+		d.router = newRouter(d.pool, d.addr, routingContext)
+	}
+
+	return d, nil
+}
+
+// NewSession returns a session using the driver's connections.
+func (d *Driver) NewSession(config SessionConfig) *Session {
+	if config.FetchSize == 0 {
+		config.FetchSize = d.config.FetchSize
+	}
+
+	return &Session{driver: d, config: config, lastBookmarks: config.Bookmarks}
+}
+
+// PoolMetrics returns the metrics of the connection pool of each server the
+// driver has connected to, keyed by address.
+func (d *Driver) PoolMetrics() map[string]PoolMetrics {
+	return d.pool.metrics()
+}
+
+// Close closes the idle connections of the driver. Connections held by open
+// sessions are closed when the sessions release them.
+func (d *Driver) Close() error {
+	return d.pool.close()
+}
+
+// connect opens an initialized connection to the server at addr and returns
+// it with the token it authenticated with.
+func (d *Driver) connect(ctx context.Context, addr string) (*bolt.Conn, AuthToken, error) {
+	token, err := d.auth.GetAuthToken(ctx)
+	if err != nil {
+		return nil, AuthToken{}, err
+	}
+
+	nc, err := d.config.Dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, AuthToken{}, err
+	}
+	if d.tls != nil {
+		if nc, err = d.handshake(ctx, nc, addr); err != nil {
+			return nil, AuthToken{}, err
+		}
+	}
+
+	conn, err := bolt.NewConn(ctx, nc)
+	if err != nil {
+		return nil, AuthToken{}, err
+	}
+
+	extra := packstream.Dictionary{"user_agent": d.config.UserAgent}
+	if d.router != nil {
+		extra["routing"] = d.router.context
+	}
+	if _, err := conn.Hello(ctx, extra, token.dictionary()); err != nil {
+		conn.Close()
+		return nil, AuthToken{}, &authError{token: token, err: err}
+	}
+
+	return conn, token, nil
+}
+
+// reauth authenticates a pooled connection with the current token if it was
+// authenticated with an older one. Connections that cannot change their
+// credentials are replaced by the pool.
+func (d *Driver) reauth(ctx context.Context, c *pooledConn) error {
+	token, err := d.auth.GetAuthToken(ctx)
+	if err != nil {
+		return err
+	}
+	if token.equal(c.auth) {
+		return nil
+	}
+
+	if !c.SupportsReauth() {
+		return fmt.Errorf("graphdb: Bolt %s cannot change credentials", c.Version())
+	}
+
+	if err := c.Logoff(ctx); err != nil {
+		return &authError{token: c.auth, err: err}
+	}
+	if err := c.Logon(ctx, token.dictionary()); err != nil {
+		return &authError{token: token, err: err}
+	}
+	c.auth = token
+
+	return nil
+}
+
+// handshake performs a TLS handshake over nc with the server at addr. It
+// closes nc if the handshake fails. The deadline of ctx is left on the
+// connection for bolt.NewConn to replace, and so is a deadline in the past
+// if ctx is done by then, which makes bolt.NewConn fail.
+func (d *Driver) handshake(ctx context.Context, nc net.Conn, addr string) (net.Conn, error) {
+	config := d.tls
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			nc.Close()
+			return nil, err
+		}
+		config = config.Clone()
+		config.ServerName = host
+	}
+
+	tc := tls.Client(nc, config)
+
+	deadline, _ := ctx.Deadline()
+	if err := tc.SetDeadline(deadline); err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	// Cancelling ctx unblocks the handshake by moving the deadline to the
+	// past.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			nc.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+
+	if err := tc.Handshake(); err != nil {
+		nc.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("graphdb: TLS handshake with %s failed: %w", addr, err)
+	}
+
+	return tc, nil
+}
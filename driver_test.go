@@ -0,0 +1,333 @@
+package graphdb
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattmeyers/graphdb/bolt"
+	"github.com/mattmeyers/graphdb/bolt/bolttest"
+)
+
+// newTestDriver starts a fake server with handler h and returns a driver
+// connecting to it.
+func newTestDriver(t *testing.T, h bolttest.Handler) *Driver {
+	t.Helper()
+
+	s := bolttest.NewServer(h)
+	t.Cleanup(s.Close)
+
+	d, err := NewDriver("bolt://"+s.Addr(), func(c *Config) { c.Dial = s.Dial })
+	if err != nil {
+		t.Fatalf("NewDriver() error = %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	return d
+}
+
+// recorder records the requests received by a fake server before passing
+// them on to next, if set.
+type recorder struct {
+	next bolttest.Handler
+
+	mu   sync.Mutex
+	reqs []bolt.Message
+}
+
+func (r *recorder) handle(req bolt.Message) []bolt.Message {
+	r.mu.Lock()
+	r.reqs = append(r.reqs, req)
+	r.mu.Unlock()
+
+	if r.next == nil {
+		return nil
+	}
+	return r.next(req)
+}
+
+// requests returns the requests received after initialization.
+func (r *recorder) requests() []bolt.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var reqs []bolt.Message
+	for _, req := range r.reqs {
+		switch req.(type) {
+		case bolt.Hello, bolt.Logon:
+			continue
+		}
+		reqs = append(reqs, req)
+	}
+
+	return reqs
+}
+
+func TestNewDriver(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		wantAddr string
+		wantTLS  bool
+		wantErr  bool
+	}{
+		{
+			name:     "host and port",
+			target:   "bolt://db.example.com:7688",
+			wantAddr: "db.example.com:7688",
+			wantErr:  false,
+		},
+		{
+			name:     "default port",
+			target:   "bolt://db.example.com",
+			wantAddr: "db.example.com:7687",
+			wantErr:  false,
+		},
+		{
+			name:     "IPv6 host",
+			target:   "bolt://[::1]",
+			wantAddr: "[::1]:7687",
+			wantErr:  false,
+		},
+		{
+			name:     "routing scheme",
+			target:   "neo4j://db.example.com?region=eu",
+			wantAddr: "db.example.com:7687",
+			wantErr:  false,
+		},
+		{
+			name:     "TLS",
+			target:   "bolt+s://db.example.com",
+			wantAddr: "db.example.com:7687",
+			wantTLS:  true,
+			wantErr:  false,
+		},
+		{
+			name:     "routing with self-signed TLS",
+			target:   "neo4j+ssc://db.example.com",
+			wantAddr: "db.example.com:7687",
+			wantTLS:  true,
+			wantErr:  false,
+		},
+		{
+			name:    "unsupported scheme",
+			target:  "http://db.example.com",
+			wantErr: true,
+		},
+		{
+			name:    "unsupported security suffix",
+			target:  "bolt+tls://db.example.com",
+			wantErr: true,
+		},
+		{
+			name:    "missing host",
+			target:  "bolt://",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewDriver(tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewDriver() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if got.addr != tt.wantAddr {
+				t.Errorf("NewDriver() addr = %v, want %v", got.addr, tt.wantAddr)
+			}
+			if (got.tls != nil) != tt.wantTLS {
+				t.Errorf("NewDriver() tls = %v, wantTLS %v", got.tls, tt.wantTLS)
+			}
+		})
+	}
+}
+
+func TestDriver_connect(t *testing.T) {
+	rec := &recorder{}
+	d := newTestDriver(t, rec.handle)
+	d.config.UserAgent = "test/1.0"
+
+	conn, _, err := d.connect(context.Background(), d.addr)
+	if err != nil {
+		t.Fatalf("Driver.connect() error = %v", err)
+	}
+	defer conn.Close()
+
+	if conn.State() != bolt.Ready {
+		t.Errorf("Conn.State() = %v, want %v", conn.State(), bolt.Ready)
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if hello := rec.reqs[0].(bolt.Hello); hello.Extra["user_agent"] != "test/1.0" {
+		t.Errorf("HELLO user_agent = %v, want %v", hello.Extra["user_agent"], "test/1.0")
+	}
+}
+
+// newCertificate issues a certificate from template, signed by parent or
+// self-signed if parent is nil.
+func newCertificate(t *testing.T, template *x509.Certificate, parent *tls.Certificate) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() error = %v", err)
+	}
+
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	issuer, signer := template, interface{}(key)
+	if parent != nil {
+		issuer, signer = parent.Leaf, parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate() error = %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("x509.ParseCertificate() error = %v", err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestDriver_tls(t *testing.T) {
+	ca := newCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+
+	server := newCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, &ca)
+	selfSigned := newCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, nil)
+	client := newCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "client"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &ca)
+
+	tests := []struct {
+		name    string
+		scheme  string
+		server  *tls.Config
+		client  *tls.Config
+		wantErr bool
+	}{
+		{
+			name:    "verified",
+			scheme:  "bolt+s",
+			server:  &tls.Config{Certificates: []tls.Certificate{server}},
+			client:  &tls.Config{RootCAs: roots},
+			wantErr: false,
+		},
+		{
+			name:    "unknown authority",
+			scheme:  "bolt+s",
+			server:  &tls.Config{Certificates: []tls.Certificate{server}},
+			wantErr: true,
+		},
+		{
+			name:    "self-signed rejected",
+			scheme:  "neo4j+s",
+			server:  &tls.Config{Certificates: []tls.Certificate{selfSigned}},
+			client:  &tls.Config{RootCAs: roots},
+			wantErr: true,
+		},
+		{
+			name:    "self-signed accepted",
+			scheme:  "bolt+ssc",
+			server:  &tls.Config{Certificates: []tls.Certificate{selfSigned}},
+			wantErr: false,
+		},
+		{
+			name:    "TLS config without suffix",
+			scheme:  "bolt",
+			server:  &tls.Config{Certificates: []tls.Certificate{server}},
+			client:  &tls.Config{RootCAs: roots},
+			wantErr: false,
+		},
+		{
+			name:    "plain connection to TLS server",
+			scheme:  "bolt",
+			server:  &tls.Config{Certificates: []tls.Certificate{server}},
+			wantErr: true,
+		},
+		{
+			name:   "client certificate",
+			scheme: "bolt+s",
+			server: &tls.Config{
+				Certificates: []tls.Certificate{server},
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+				ClientCAs:    roots,
+			},
+			client:  &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{client}},
+			wantErr: false,
+		},
+		{
+			name:   "missing client certificate",
+			scheme: "bolt+s",
+			server: &tls.Config{
+				Certificates: []tls.Certificate{server},
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+				ClientCAs:    roots,
+			},
+			client:  &tls.Config{RootCAs: roots},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := bolttest.NewUnstartedServer(nil)
+			s.TLS = tt.server
+			s.Start()
+			t.Cleanup(s.Close)
+
+			d, err := NewDriver(tt.scheme+"://"+s.Addr(), func(c *Config) { c.TLSConfig = tt.client })
+			if err != nil {
+				t.Fatalf("NewDriver() error = %v", err)
+			}
+			defer d.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			conn, _, err := d.connect(ctx, d.addr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Driver.connect() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			if conn.State() != bolt.Ready {
+				t.Errorf("Conn.State() = %v, want %v", conn.State(), bolt.Ready)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package graphdb
+
+import "github.com/mattmeyers/graphdb/bolt"
+
+// Neo4jError is an error reported by the server. See bolt.Neo4jError.
+type Neo4jError = bolt.Neo4jError
+
+// IsTransient reports whether err is a transient server error, so the failed
+// work may succeed if retried.
+func IsTransient(err error) bool {
+	return bolt.IsTransient(err)
+}
+
+// IsAuthError reports whether err is a server error caused by invalid or
+// expired credentials.
+func IsAuthError(err error) bool {
+	return bolt.IsAuthError(err)
+}
+
+// IsConstraintViolation reports whether err is a server error caused by a
+// write violating a schema constraint.
+func IsConstraintViolation(err error) bool {
+	return bolt.IsConstraintViolation(err)
+}
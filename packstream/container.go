@@ -1,8 +1,6 @@
 package packstream
 
 import (
-	"bytes"
-	"encoding/binary"
 	"errors"
 )
 
@@ -21,18 +19,15 @@ var shortListMarkers = [16]byte{
 	0x9C, 0x9D, 0x9E, 0x9F,
 }
 
-func (l List) writeMarker(buf *bytes.Buffer) (err error) {
-	if len(l) < (1 << 4) {
-		buf.WriteByte(shortListMarkers[len(l)])
-	} else if len(l) < (1 << 8) {
-		buf.WriteByte(0xD4)
-		buf.WriteByte(byte(len(l)))
-	} else if len(l) < (1 << 16) {
-		buf.WriteByte(0xD5)
-		binary.Write(buf, binary.BigEndian, uint16(len(l)))
-	} else if len(l) < (1 << 32) {
-		buf.WriteByte(0xD6)
-		binary.Write(buf, binary.BigEndian, uint32(len(l)))
+func writeListHeader(e *encoder, size int) (err error) {
+	if size < (1 << 4) {
+		e.w.WriteByte(shortListMarkers[size])
+	} else if size < (1 << 8) {
+		e.writeHeader(0xD4, size, 1)
+	} else if size < (1 << 16) {
+		e.writeHeader(0xD5, size, 2)
+	} else if size < (1 << 32) {
+		e.writeHeader(0xD6, size, 4)
 	} else {
 		err = errors.New("cannot encode List with more than 2,147,483,647 elements")
 	}
@@ -41,22 +36,21 @@ func (l List) writeMarker(buf *bytes.Buffer) (err error) {
 }
 
 func (l List) MarshalPackstream() ([]byte, error) {
-	buf := new(bytes.Buffer)
+	return Marshal(l)
+}
 
-	if err := l.writeMarker(buf); err != nil {
-		return nil, err
+func (l List) encodePackstream(e *encoder) error {
+	if err := writeListHeader(e, len(l)); err != nil {
+		return err
 	}
 
 	for _, item := range l {
-		b, err := Marshal(item)
-		if err != nil {
-			return nil, err
+		if err := e.marshal(item); err != nil {
+			return err
 		}
-
-		buf.Write(b)
 	}
 
-	return buf.Bytes(), nil
+	return nil
 }
 
 type Dictionary map[string]interface{}
@@ -70,18 +64,15 @@ var shortDictionaryMarkers = [16]byte{
 	0xAC, 0xAD, 0xAE, 0xAF,
 }
 
-func (d Dictionary) writeMarker(buf *bytes.Buffer) (err error) {
-	if len(d) < (1 << 4) {
-		buf.WriteByte(shortDictionaryMarkers[len(d)])
-	} else if len(d) < (1 << 8) {
-		buf.WriteByte(0xD8)
-		buf.WriteByte(byte(len(d)))
-	} else if len(d) < (1 << 16) {
-		buf.WriteByte(0xD9)
-		binary.Write(buf, binary.BigEndian, uint16(len(d)))
-	} else if len(d) < (1 << 32) {
-		buf.WriteByte(0xDA)
-		binary.Write(buf, binary.BigEndian, uint32(len(d)))
+func writeDictionaryHeader(e *encoder, size int) (err error) {
+	if size < (1 << 4) {
+		e.w.WriteByte(shortDictionaryMarkers[size])
+	} else if size < (1 << 8) {
+		e.writeHeader(0xD8, size, 1)
+	} else if size < (1 << 16) {
+		e.writeHeader(0xD9, size, 2)
+	} else if size < (1 << 32) {
+		e.writeHeader(0xDA, size, 4)
 	} else {
 		err = errors.New("cannot encode Dictionary with more than 2,147,483,647 key-value pairs")
 	}
@@ -90,25 +81,23 @@ func (d Dictionary) writeMarker(buf *bytes.Buffer) (err error) {
 }
 
 func (d Dictionary) MarshalPackstream() ([]byte, error) {
-	buf := new(bytes.Buffer)
+	return Marshal(d)
+}
 
-	if err := d.writeMarker(buf); err != nil {
-		return nil, err
+func (d Dictionary) encodePackstream(e *encoder) error {
+	if err := writeDictionaryHeader(e, len(d)); err != nil {
+		return err
 	}
 
 	for k, v := range d {
-		ek, err := Marshal(k)
-		if err != nil {
-			return nil, err
+		if err := e.encodeString(k); err != nil {
+			return err
 		}
-		buf.Write(ek)
 
-		ev, err := Marshal(v)
-		if err != nil {
-			return nil, err
+		if err := e.marshal(v); err != nil {
+			return err
 		}
-		buf.Write(ev)
 	}
 
-	return buf.Bytes(), nil
+	return nil
 }
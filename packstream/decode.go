@@ -0,0 +1,729 @@
+package packstream
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// Unmarshaler is implemented by types that can decode a packstream encoding of
+// themselves. The input is the complete encoding of a single value.
+// UnmarshalPackstream must copy the data if it wishes to retain it.
+type Unmarshaler interface {
+	UnmarshalPackstream([]byte) error
+}
+
+var unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+
+type decoder struct {
+	r       io.Reader
+	scratch [8]byte
+	// rec collects every byte read while non-nil so that the encoding of a
+	// value can be handed to an Unmarshaler.
+	rec *bytes.Buffer
+	// depth is the number of lists, dictionaries and structures the value
+	// being read is nested in.
+	depth int
+}
+
+const (
+	// maxDepth limits the nesting of values so that deeply nested input
+	// fails instead of exhausting the stack.
+	maxDepth = 1000
+
+	// maxPrealloc limits the memory allocated up front from a size read
+	// from the input. Larger values grow as their contents are read, so a
+	// bogus size fails with a short read rather than a huge allocation.
+	maxPrealloc = 1024
+)
+
+var errMaxDepth = fmt.Errorf("value exceeds the maximum nesting depth of %d", maxDepth)
+
+// Unmarshal parses the packstream encoded value in data and stores the result
+// in the value pointed to by v.
+//
+// Unmarshal allocates pointers as needed and converts packstream values into
+// the Go type of the destination. Integers can be stored in any Go integer
+// type provided the value fits, and floats in float32 or float64. Lists are
+// stored in slices and arrays. Dictionaries are stored in maps with string
+// keys or in structs, matching keys to the packstream tag of each field or
+// case-insensitively to its name. The Properties of a Node or relationship
+// can be stored the same way as a Dictionary.
+//
+// When v points to an empty interface, the decoded value is stored as one of
+// the following types:
+//
+//	Null        nil
+//	Boolean     bool
+//	Integer     int64
+//	Float       float64
+//	Bytes       []byte
+//	String      string
+//	List        List
+//	Dictionary  Dictionary
+//	Structure   the registered structure type, e.g. Node, or RawStructure
+//
+// The data must contain exactly one value. Trailing bytes result in an error.
+func Unmarshal(data []byte, v interface{}) error {
+	r := bytes.NewReader(data)
+	d := decoder{r: r}
+
+	err := d.decode(v)
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	} else if err != nil {
+		return err
+	}
+
+	if r.Len() > 0 {
+		return fmt.Errorf("unexpected %d bytes of trailing data", r.Len())
+	}
+
+	return nil
+}
+
+// A Decoder reads and decodes packstream values from an input stream.
+type Decoder struct {
+	d decoder
+}
+
+// NewDecoder returns a new decoder that reads from r.
+//
+// If r does not implement io.ByteReader, the decoder wraps it in a
+// bufio.Reader and may read data from r beyond the values requested.
+func NewDecoder(r io.Reader) *Decoder {
+	if _, ok := r.(io.ByteReader); !ok {
+		r = bufio.NewReader(r)
+	}
+
+	return &Decoder{d: decoder{r: r}}
+}
+
+// Decode reads the next packstream value from its input and stores it in the
+// value pointed to by v. See the documentation for Unmarshal for details
+// about the conversion of packstream values into Go values.
+//
+// Decode returns io.EOF when the input ends cleanly between two values and
+// io.ErrUnexpectedEOF when it ends in the middle of a value.
+func (dec *Decoder) Decode(v interface{}) error {
+	return dec.d.decode(v)
+}
+
+// Assign stores val, a value decoded by this package such as a Dictionary,
+// in the value pointed to by v. It follows the rules of Unmarshal without
+// going through an encoding, except for destinations implementing
+// Unmarshaler. Errors storing the entries of a Dictionary in a struct name
+// the field that failed.
+func Assign(v interface{}, val interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("unable to assign to non-pointer value of type %T", v)
+	}
+
+	return assign(rv.Elem(), val)
+}
+
+func (d *decoder) decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("unable to unmarshal into non-pointer value of type %T", v)
+	}
+
+	if s, ok := v.(*RawStructure); ok {
+		return d.decodeRawStructure(s)
+	}
+
+	if u, ok := v.(Unmarshaler); ok {
+		raw, err := d.readRaw()
+		if err != nil {
+			return err
+		}
+		return u.UnmarshalPackstream(raw)
+	}
+
+	val, err := d.decodeValue()
+	if err != nil {
+		return err
+	}
+
+	return assign(rv.Elem(), val)
+}
+
+// read reads exactly n bytes. The returned slice is only valid until the next
+// call to read when n is at most 8 bytes.
+func (d *decoder) read(n int) ([]byte, error) {
+	var b []byte
+	if n <= len(d.scratch) {
+		b = d.scratch[:n]
+	} else {
+		b = make([]byte, n)
+	}
+
+	if err := d.readFull(b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (d *decoder) readFull(b []byte) error {
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		return err
+	}
+
+	if d.rec != nil {
+		d.rec.Write(b)
+	}
+
+	return nil
+}
+
+// readMarker reads the marker byte at the start of a value. Unlike the other
+// read methods, io.EOF is returned as is since no part of a value was consumed.
+func (d *decoder) readMarker() (byte, error) {
+	if err := d.readFull(d.scratch[:1]); err != nil {
+		return 0, err
+	}
+
+	return d.scratch[0], nil
+}
+
+// readSize reads an unsigned big endian size of n bytes.
+func (d *decoder) readSize(n int) (int, error) {
+	b, err := d.read(n)
+	if err != nil {
+		return 0, err
+	}
+
+	switch n {
+	case 1:
+		return int(b[0]), nil
+	case 2:
+		return int(binary.BigEndian.Uint16(b)), nil
+	default:
+		return int(binary.BigEndian.Uint32(b)), nil
+	}
+}
+
+func (d *decoder) decodeValue() (interface{}, error) {
+	marker, err := d.readMarker()
+	if err != nil {
+		return nil, err
+	}
+
+	if d.depth >= maxDepth {
+		return nil, errMaxDepth
+	}
+	d.depth++
+	val, err := d.decodeMarker(marker)
+	d.depth--
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return val, err
+}
+
+func (d *decoder) decodeMarker(marker byte) (interface{}, error) {
+	switch {
+	case marker <= 0x7F: // TINY_INT
+		return int64(marker), nil
+	case marker >= 0xF0: // TINY_INT
+		return int64(int8(marker)), nil
+	case marker <= 0x8F:
+		return d.decodeString(int(marker & 0x0F))
+	case marker <= 0x9F:
+		return d.decodeList(int(marker & 0x0F))
+	case marker <= 0xAF:
+		return d.decodeDictionary(int(marker & 0x0F))
+	case marker <= 0xBF:
+		return d.decodeStructure(int(marker & 0x0F))
+	}
+
+	switch marker {
+	case 0xC0:
+		return nil, nil
+	case 0xC1:
+		b, err := d.read(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case 0xC2:
+		return false, nil
+	case 0xC3:
+		return true, nil
+	case 0xC8:
+		b, err := d.read(1)
+		if err != nil {
+			return nil, err
+		}
+		return int64(int8(b[0])), nil
+	case 0xC9:
+		b, err := d.read(2)
+		if err != nil {
+			return nil, err
+		}
+		return int64(int16(binary.BigEndian.Uint16(b))), nil
+	case 0xCA:
+		b, err := d.read(4)
+		if err != nil {
+			return nil, err
+		}
+		return int64(int32(binary.BigEndian.Uint32(b))), nil
+	case 0xCB:
+		b, err := d.read(8)
+		if err != nil {
+			return nil, err
+		}
+		return int64(binary.BigEndian.Uint64(b)), nil
+	case 0xCC, 0xCD, 0xCE:
+		size, err := d.readSize(1 << (marker - 0xCC))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeBytes(size)
+	case 0xD0, 0xD1, 0xD2:
+		size, err := d.readSize(1 << (marker - 0xD0))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeString(size)
+	case 0xD4, 0xD5, 0xD6:
+		size, err := d.readSize(1 << (marker - 0xD4))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeList(size)
+	case 0xD8, 0xD9, 0xDA:
+		size, err := d.readSize(1 << (marker - 0xD8))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeDictionary(size)
+	}
+
+	return nil, fmt.Errorf("unknown marker byte 0x%02X", marker)
+}
+
+func (d *decoder) decodeBytes(size int) ([]byte, error) {
+	if size <= maxPrealloc {
+		b := make([]byte, size)
+		if err := d.readFull(b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(maxPrealloc)
+	if _, err := io.CopyN(&buf, d.r, int64(size)); err != nil {
+		return nil, err
+	}
+
+	if d.rec != nil {
+		d.rec.Write(buf.Bytes())
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (d *decoder) decodeString(size int) (string, error) {
+	b, err := d.decodeBytes(size)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+func (d *decoder) decodeList(size int) (List, error) {
+	l := make(List, 0, minInt(size, maxPrealloc))
+	for i := 0; i < size; i++ {
+		v, err := d.decodeValue()
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, v)
+	}
+
+	return l, nil
+}
+
+func (d *decoder) decodeDictionary(size int) (Dictionary, error) {
+	dict := make(Dictionary, minInt(size, maxPrealloc))
+	for i := 0; i < size; i++ {
+		k, err := d.decodeValue()
+		if err != nil {
+			return nil, err
+		}
+
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot decode Dictionary key of type %T", k)
+		}
+
+		v, err := d.decodeValue()
+		if err != nil {
+			return nil, err
+		}
+		dict[key] = v
+	}
+
+	return dict, nil
+}
+
+func (d *decoder) decodeStructure(size int) (interface{}, error) {
+	b, err := d.read(1)
+	if err != nil {
+		return nil, err
+	}
+	tag := b[0]
+
+	s := lookupStructure(tag)
+	if s == nil {
+		fields, err := d.decodeList(size)
+		if err != nil {
+			return nil, err
+		}
+		return RawStructure{Signature: tag, Fields: fields}, nil
+	}
+
+	// The marker and tag have already been consumed, so they are written to
+	// the recording ahead of the fields.
+	d.rec = bytes.NewBuffer([]byte{structMarkers[size], tag})
+	for i := 0; i < size; i++ {
+		if err := d.skip(); err != nil {
+			d.rec = nil
+			return nil, err
+		}
+	}
+	raw := d.rec.Bytes()
+	d.rec = nil
+
+	if err := s.UnmarshalPackstream(raw); err != nil {
+		return nil, err
+	}
+
+	return derefStructure(s), nil
+}
+
+// readRaw reads a complete value and returns its encoding.
+func (d *decoder) readRaw() ([]byte, error) {
+	d.rec = new(bytes.Buffer)
+	defer func() { d.rec = nil }()
+
+	if err := d.skip(); err != nil {
+		return nil, err
+	}
+
+	return d.rec.Bytes(), nil
+}
+
+// skip reads past a complete value without decoding it. As with decodeValue,
+// io.EOF is only returned if the input ends before the value starts.
+func (d *decoder) skip() error {
+	marker, err := d.readMarker()
+	if err != nil {
+		return err
+	}
+
+	if d.depth >= maxDepth {
+		return errMaxDepth
+	}
+	d.depth++
+	err = d.skipMarker(marker)
+	d.depth--
+
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (d *decoder) skipMarker(marker byte) error {
+	switch {
+	case marker <= 0x7F || marker >= 0xF0:
+		return nil
+	case marker <= 0x8F:
+		return d.discard(int(marker & 0x0F))
+	case marker <= 0x9F:
+		return d.skipN(int(marker & 0x0F))
+	case marker <= 0xAF:
+		return d.skipN(2 * int(marker&0x0F))
+	case marker <= 0xBF:
+		if err := d.discard(1); err != nil { // tag
+			return err
+		}
+		return d.skipN(int(marker & 0x0F))
+	}
+
+	var size int
+	var err error
+
+	switch marker {
+	case 0xC0, 0xC2, 0xC3:
+		return nil
+	case 0xC1, 0xCB:
+		return d.discard(8)
+	case 0xC8:
+		return d.discard(1)
+	case 0xC9:
+		return d.discard(2)
+	case 0xCA:
+		return d.discard(4)
+	case 0xCC, 0xCD, 0xCE:
+		if size, err = d.readSize(1 << (marker - 0xCC)); err != nil {
+			return err
+		}
+		return d.discard(size)
+	case 0xD0, 0xD1, 0xD2:
+		if size, err = d.readSize(1 << (marker - 0xD0)); err != nil {
+			return err
+		}
+		return d.discard(size)
+	case 0xD4, 0xD5, 0xD6:
+		if size, err = d.readSize(1 << (marker - 0xD4)); err != nil {
+			return err
+		}
+		return d.skipN(size)
+	case 0xD8, 0xD9, 0xDA:
+		if size, err = d.readSize(1 << (marker - 0xD8)); err != nil {
+			return err
+		}
+		return d.skipN(2 * size)
+	}
+
+	return fmt.Errorf("unknown marker byte 0x%02X", marker)
+}
+
+func (d *decoder) skipN(n int) error {
+	for i := 0; i < n; i++ {
+		if err := d.skip(); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// discard reads past n bytes, recording them if required.
+func (d *decoder) discard(n int) error {
+	var dst io.Writer = io.Discard
+	if d.rec != nil {
+		dst = d.rec
+	}
+
+	if _, err := io.CopyN(dst, d.r, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	return nil
+}
+
+// assign stores the decoded value val in dst, converting it to the Go type of
+// dst where needed. Nil pointers are allocated as required.
+func assign(dst reflect.Value, val interface{}) error {
+	if dst.Kind() == reflect.Ptr && val != nil {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return assign(dst.Elem(), val)
+	}
+
+	if val == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+
+	rv := reflect.ValueOf(val)
+	if rv.Type().AssignableTo(dst.Type()) {
+		dst.Set(rv)
+		return nil
+	}
+
+	// The original encoding is no longer available at this point, so the
+	// value is encoded again for the Unmarshaler.
+	if dst.CanAddr() && dst.Addr().Type().Implements(unmarshalerType) && dst.Addr().CanInterface() {
+		b, err := Marshal(val)
+		if err != nil {
+			return err
+		}
+		return dst.Addr().Interface().(Unmarshaler).UnmarshalPackstream(b)
+	}
+
+	switch v := val.(type) {
+	case bool:
+		if dst.Kind() == reflect.Bool {
+			dst.SetBool(v)
+			return nil
+		}
+	case int64:
+		return assignInt(dst, v)
+	case float64:
+		switch dst.Kind() {
+		case reflect.Float32, reflect.Float64:
+			if dst.OverflowFloat(v) {
+				return fmt.Errorf("float %g overflows Go value of type %s", v, dst.Type())
+			}
+			dst.SetFloat(v)
+			return nil
+		}
+	case string:
+		if dst.Kind() == reflect.String {
+			dst.SetString(v)
+			return nil
+		}
+	case []byte:
+		if dst.Kind() == reflect.Slice && dst.Type().Elem().Kind() == reflect.Uint8 {
+			dst.SetBytes(v)
+			return nil
+		}
+	case List:
+		return assignList(dst, v)
+	case Dictionary:
+		return assignDictionary(dst, v)
+	case Node:
+		return assignDictionary(dst, v.Properties)
+	case Relationship:
+		return assignDictionary(dst, v.Properties)
+	case UnboundRelationship:
+		return assignDictionary(dst, v.Properties)
+	}
+
+	return unmarshalTypeError(val, dst)
+}
+
+func unmarshalTypeError(val interface{}, dst reflect.Value) error {
+	return fmt.Errorf("cannot unmarshal %T into Go value of type %s", val, dst.Type())
+}
+
+func assignInt(dst reflect.Value, v int64) error {
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if dst.OverflowInt(v) {
+			return fmt.Errorf("integer %d overflows Go value of type %s", v, dst.Type())
+		}
+		dst.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v < 0 || dst.OverflowUint(uint64(v)) {
+			return fmt.Errorf("integer %d overflows Go value of type %s", v, dst.Type())
+		}
+		dst.SetUint(uint64(v))
+	case reflect.Float32, reflect.Float64:
+		dst.SetFloat(float64(v))
+	default:
+		return unmarshalTypeError(v, dst)
+	}
+
+	return nil
+}
+
+// assignList stores the items of l in a slice or array. Arrays longer than
+// the List have their remaining elements zeroed while extra List items are
+// dropped.
+func assignList(dst reflect.Value, l List) error {
+	switch dst.Kind() {
+	case reflect.Slice:
+		dst.Set(reflect.MakeSlice(dst.Type(), len(l), len(l)))
+	case reflect.Array:
+		dst.Set(reflect.Zero(dst.Type()))
+	default:
+		return unmarshalTypeError(l, dst)
+	}
+
+	for i, item := range l {
+		if i >= dst.Len() {
+			break
+		}
+
+		if err := assign(dst.Index(i), item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// assignDictionary stores the entries of d in a map with string keys or in
+// the fields of a struct. Struct fields are matched by their packstream tag
+// or case-insensitively by field name. Entries without a matching field are
+// ignored.
+func assignDictionary(dst reflect.Value, d Dictionary) error {
+	switch dst.Kind() {
+	case reflect.Map:
+		t := dst.Type()
+		if t.Key().Kind() != reflect.String {
+			break
+		}
+
+		m := reflect.MakeMapWithSize(t, len(d))
+		for k, v := range d {
+			elem := reflect.New(t.Elem()).Elem()
+			if err := assign(elem, v); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(k).Convert(t.Key()), elem)
+		}
+		dst.Set(m)
+
+		return nil
+	case reflect.Struct:
+		fields := cachedFields(dst.Type())
+		for k, v := range d {
+			f := matchField(fields, k)
+			if f == nil {
+				continue
+			}
+
+			if err := assign(fieldByIndexAlloc(dst, f.index), v); err != nil {
+				return fmt.Errorf("field %s: %w", f.name, err)
+			}
+		}
+
+		return nil
+	}
+
+	return unmarshalTypeError(d, dst)
+}
+
+// matchField returns the field named key, preferring an exact match over a
+// case-insensitive one.
+func matchField(fields []field, key string) *field {
+	var fold *field
+	for i := range fields {
+		if fields[i].name == key {
+			return &fields[i]
+		}
+		if fold == nil && strings.EqualFold(fields[i].name, key) {
+			fold = &fields[i]
+		}
+	}
+
+	return fold
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
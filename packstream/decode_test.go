@@ -0,0 +1,617 @@
+package packstream
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestUnmarshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name:    "null",
+			data:    []byte{0xC0},
+			want:    nil,
+			wantErr: false,
+		},
+		{
+			name:    "true",
+			data:    []byte{0xC3},
+			want:    true,
+			wantErr: false,
+		},
+		{
+			name:    "negative tiny int",
+			data:    []byte{0xF0},
+			want:    int64(-16),
+			wantErr: false,
+		},
+		{
+			name:    "negative 64 bit int",
+			data:    []byte{0xCB, 0xFF, 0xFF, 0xFF, 0xFF, 0x7F, 0xFF, 0xFF, 0xFF},
+			want:    int64(-2_147_483_649),
+			wantErr: false,
+		},
+		{
+			name:    "float",
+			data:    []byte{0xC1, 0x3F, 0xF3, 0xAE, 0x14, 0x7A, 0xE1, 0x47, 0xAE},
+			want:    1.23,
+			wantErr: false,
+		},
+		{
+			name:    "bytes",
+			data:    []byte{0xCC, 0x03, 0x61, 0x62, 0x63},
+			want:    []byte{0x61, 0x62, 0x63},
+			wantErr: false,
+		},
+		{
+			name:    "8 bit string",
+			data:    []byte{0xD0, 0x03, 0x61, 0x62, 0x63},
+			want:    "abc",
+			wantErr: false,
+		},
+		{
+			name:    "list with mixed elements",
+			data:    []byte{0x92, 0xC3, 0x81, 0x61},
+			want:    List{true, "a"},
+			wantErr: false,
+		},
+		{
+			name:    "dictionary",
+			data:    []byte{0xA1, 0x81, 0x61, 0x01},
+			want:    Dictionary{"a": int64(1)},
+			wantErr: false,
+		},
+		{
+			name:    "node",
+			data:    []byte{0xB3, 0x4E, 0x01, 0x91, 0x81, 0x41, 0xA1, 0x81, 0x61, 0x01},
+			want:    Node{ID: 1, Labels: List{"A"}, Properties: Dictionary{"a": int64(1)}},
+			wantErr: false,
+		},
+		{
+			name: "relationship",
+			data: []byte{0xB5, 0x52, 0x01, 0x02, 0x03, 0x81, 0x52, 0xA0},
+			want: Relationship{
+				ID:          1,
+				StartNodeID: 2,
+				EndNodeID:   3,
+				Type:        "R",
+				Properties:  Dictionary{},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "point",
+			data:    []byte{0xB3, 0x58, 0x01, 0xC1, 0x3F, 0xF3, 0xAE, 0x14, 0x7A, 0xE1, 0x47, 0xAE, 0xC1, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			want:    Point2D{SRID: 1, X: 1.23, Y: 0},
+			wantErr: false,
+		},
+		{
+			name:    "structure with wrong field count",
+			data:    []byte{0xB1, 0x4E, 0x01},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "unknown structure tag",
+			data:    []byte{0xB1, 0x01, 0x81, 0x61},
+			want:    RawStructure{Signature: 0x01, Fields: List{"a"}},
+			wantErr: false,
+		},
+		{
+			name:    "unknown marker",
+			data:    []byte{0xDF},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "trailing data",
+			data:    []byte{0xC0, 0xC0},
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got interface{}
+			err := Unmarshal(tt.data, &got)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_truncated(t *testing.T) {
+	for _, data := range [][]byte{{}, {0xC9, 0x00}, {0x92, 0xC3}, {0xD0, 0x03, 0x61}} {
+		var got interface{}
+		if err := Unmarshal(data, &got); err != io.ErrUnexpectedEOF {
+			t.Errorf("Unmarshal(%x) error = %v, want %v", data, err, io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+func TestUnmarshal_hugeSize(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "list", data: []byte{0xD6, 0x10, 0x00, 0x00, 0x00}},
+		{name: "bytes", data: []byte{0xCE, 0x7F, 0xFF, 0xFF, 0xFF, 0x01}},
+		{name: "string", data: []byte{0xD2, 0x7F, 0xFF, 0xFF, 0xFF, 0x61}},
+		{name: "dictionary", data: []byte{0xDA, 0x10, 0x00, 0x00, 0x00, 0x81, 0x61, 0x01}},
+		{name: "structure field", data: []byte{0xB1, 0x44, 0xD6, 0x10, 0x00, 0x00, 0x00}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got interface{}
+			if err := Unmarshal(tt.data, &got); err != io.ErrUnexpectedEOF {
+				t.Errorf("Unmarshal() error = %v, want %v", err, io.ErrUnexpectedEOF)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_depth(t *testing.T) {
+	nested := func(depth int) []byte {
+		b := bytes.Repeat([]byte{0x91}, depth)
+		return append(b, 0xC0)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		dst     interface{}
+		wantErr bool
+	}{
+		{name: "at limit", data: nested(maxDepth - 1), dst: new(interface{})},
+		{name: "too deep", data: nested(maxDepth), dst: new(interface{}), wantErr: true},
+		{name: "very deep", data: nested(1 << 20), dst: new(interface{}), wantErr: true},
+		{name: "unmarshaler", data: nested(1 << 20), dst: new(upperString), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Unmarshal(tt.data, tt.dst)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_typed(t *testing.T) {
+	var n Node
+	if err := Unmarshal([]byte{0xB3, 0x4E, 0x01, 0x90, 0xA0}, &n); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if want := (Node{ID: 1, Labels: List{}, Properties: Dictionary{}}); !reflect.DeepEqual(n, want) {
+		t.Errorf("Unmarshal() = %#v, want %#v", n, want)
+	}
+
+	var i8 int8
+	if err := Unmarshal([]byte{0xC9, 0x00, 0x80}, &i8); err == nil {
+		t.Errorf("Unmarshal() expected overflow error, got %d", i8)
+	}
+
+	if err := Unmarshal([]byte{0xC0}, nil); err == nil {
+		t.Error("Unmarshal() expected error for nil destination")
+	}
+}
+
+// TestUnmarshal_roundTrip decodes every successful Marshal test case and
+// checks that encoding the decoded value yields the original bytes.
+func TestUnmarshal_roundTrip(t *testing.T) {
+	for _, tt := range marshalTests {
+		if tt.wantErr {
+			continue
+		}
+
+		t.Run(tt.name, func(t *testing.T) {
+			var v interface{}
+			if err := Unmarshal(tt.want, &v); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+
+			got, err := Marshal(v)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Marshal(Unmarshal()) = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRawStructure_UnmarshalPackstream(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    RawStructure
+		wantErr bool
+	}{
+		{
+			name: "unknown signature",
+			data: []byte{0xB2, 0x7A, 0x01, 0x81, 0x61},
+			want: RawStructure{Signature: 0x7A, Fields: List{int64(1), "a"}},
+		},
+		{
+			name: "registered signature",
+			data: []byte{0xB1, 0x44, 0xC9, 0x00, 0x80},
+			want: RawStructure{Signature: 0x44, Fields: List{int64(128)}},
+		},
+		{
+			name: "nested unknown signature",
+			data: []byte{0xB1, 0x7A, 0xB0, 0x7B},
+			want: RawStructure{Signature: 0x7A, Fields: List{RawStructure{Signature: 0x7B, Fields: List{}}}},
+		},
+		{
+			name:    "not a structure",
+			data:    []byte{0x91, 0x01},
+			wantErr: true,
+		},
+		{
+			name:    "truncated",
+			data:    []byte{0xB2, 0x7A, 0x01},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got RawStructure
+			err := Unmarshal(tt.data, &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal() = %#v, want %#v", got, tt.want)
+			}
+
+			data, err := Marshal(got)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(data, tt.data) {
+				t.Errorf("Marshal(Unmarshal()) = %x, want %x", data, tt.data)
+			}
+		})
+	}
+}
+
+func TestAssign(t *testing.T) {
+	type person struct {
+		Name string `packstream:"name"`
+		Age  int    `packstream:"age"`
+	}
+
+	tests := []struct {
+		name    string
+		val     interface{}
+		dst     interface{}
+		want    interface{}
+		wantErr string
+	}{
+		{
+			name: "dictionary into struct",
+			val:  Dictionary{"name": "Alice", "age": int64(42), "other": true},
+			dst:  new(person),
+			want: &person{Name: "Alice", Age: 42},
+		},
+		{
+			name: "node into struct",
+			val:  Node{ID: 1, Properties: Dictionary{"name": "Alice"}},
+			dst:  new(person),
+			want: &person{Name: "Alice"},
+		},
+		{
+			name: "list into slice",
+			val:  List{int64(1), int64(2)},
+			dst:  new([]int8),
+			want: &[]int8{1, 2},
+		},
+		{
+			name:    "mismatched field",
+			val:     Dictionary{"age": "old"},
+			dst:     new(person),
+			wantErr: "field age: cannot unmarshal string into Go value of type int",
+		},
+		{
+			name:    "non-pointer",
+			val:     int64(1),
+			dst:     0,
+			wantErr: "unable to assign to non-pointer value of type int",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Assign(tt.dst, tt.val)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Assign() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Assign() error = %v", err)
+			}
+			if !reflect.DeepEqual(tt.dst, tt.want) {
+				t.Errorf("Assign() = %#v, want %#v", tt.dst, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecoder_Decode(t *testing.T) {
+	data := []byte{
+		0xC3,
+		0x92, 0x01, 0x81, 0x61,
+		0xB1, 0x44, 0xC9, 0x00, 0x80,
+	}
+	dec := NewDecoder(iotest.OneByteReader(bytes.NewReader(data)))
+
+	want := []interface{}{true, List{int64(1), "a"}, Date{Days: 128}}
+	for _, w := range want {
+		var got interface{}
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("Decoder.Decode() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, w) {
+			t.Errorf("Decoder.Decode() = %#v, want %#v", got, w)
+		}
+	}
+
+	var v interface{}
+	if err := dec.Decode(&v); err != io.EOF {
+		t.Errorf("Decoder.Decode() error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestDecoder_Decode_unexpectedEOF(t *testing.T) {
+	dec := NewDecoder(bytes.NewReader([]byte{0xC3, 0xA1, 0x81, 0x61}))
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		t.Fatalf("Decoder.Decode() error = %v", err)
+	}
+	if err := dec.Decode(&v); err != io.ErrUnexpectedEOF {
+		t.Errorf("Decoder.Decode() error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestUnmarshal_reflect(t *testing.T) {
+	type Embedded struct {
+		Extra string
+	}
+
+	type person struct {
+		*Embedded
+		Name    string `packstream:"full_name"`
+		Age     uint8
+		Score   float32
+		Tags    []string
+		Friends map[string]int
+		Parent  *person
+		Skipped string `packstream:"-"`
+	}
+
+	tests := []struct {
+		name    string
+		v       interface{}
+		dst     interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name: "dictionary into struct",
+			v: Dictionary{
+				"full_name": "Alice",
+				"AGE":       42,
+				"score":     1.5,
+				"tags":      List{"a", "b"},
+				"friends":   Dictionary{"bob": 1},
+				"parent":    Dictionary{"full_name": "Carol"},
+				"extra":     "x",
+				"skipped":   "x",
+				"unknown":   true,
+			},
+			dst: new(person),
+			want: &person{
+				Embedded: &Embedded{Extra: "x"},
+				Name:     "Alice",
+				Age:      42,
+				Score:    1.5,
+				Tags:     []string{"a", "b"},
+				Friends:  map[string]int{"bob": 1},
+				Parent:   &person{Name: "Carol"},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "node properties into struct",
+			v:       Node{ID: 1, Labels: List{"Person"}, Properties: Dictionary{"full_name": "Alice"}},
+			dst:     new(person),
+			want:    &person{Name: "Alice"},
+			wantErr: false,
+		},
+		{
+			name:    "node properties into map",
+			v:       Node{ID: 1, Labels: List{}, Properties: Dictionary{"a": 1}},
+			dst:     new(map[string]int64),
+			want:    &map[string]int64{"a": 1},
+			wantErr: false,
+		},
+		{
+			name:    "list into array",
+			v:       List{1, 2, 3},
+			dst:     new([2]int16),
+			want:    &[2]int16{1, 2},
+			wantErr: false,
+		},
+		{
+			name:    "pointer to pointer",
+			v:       "abc",
+			dst:     new(*string),
+			want:    func() **string { s := strPtr("abc"); return &s }(),
+			wantErr: false,
+		},
+		{
+			name:    "null into pointer",
+			v:       nil,
+			dst:     func() **string { s := strPtr("abc"); return &s }(),
+			want:    new(*string),
+			wantErr: false,
+		},
+		{
+			name:    "integer into float",
+			v:       3,
+			dst:     new(float64),
+			want:    func() *float64 { f := 3.0; return &f }(),
+			wantErr: false,
+		},
+		{
+			name:    "named types",
+			v:       List{"a"},
+			dst:     new([]namedString),
+			want:    &[]namedString{"a"},
+			wantErr: false,
+		},
+		{
+			name:    "negative integer into uint",
+			v:       -1,
+			dst:     new(uint),
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "integer overflow",
+			v:       1 << 40,
+			dst:     new(int32),
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "float overflow",
+			v:       1e300,
+			dst:     new(float32),
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "string into int",
+			v:       "abc",
+			dst:     new(int),
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "nested field error",
+			v:       Dictionary{"age": "old"},
+			dst:     new(person),
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Marshal(tt.v)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+
+			err = Unmarshal(data, tt.dst)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(tt.dst, tt.want) {
+				t.Errorf("Unmarshal() = %#v, want %#v", tt.dst, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_interface(t *testing.T) {
+	data, err := Marshal(map[string]interface{}{"a": []int{1}, "b": 1.5})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	var got interface{}
+	if err := Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	want := Dictionary{"a": List{int64(1)}, "b": 1.5}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unmarshal() = %#v, want %#v", got, want)
+	}
+}
+
+// upperString is a custom Unmarshaler that upper cases decoded strings.
+type upperString string
+
+func (s *upperString) UnmarshalPackstream(data []byte) error {
+	var v string
+	if err := Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*s = upperString(strings.ToUpper(v))
+
+	return nil
+}
+
+func TestUnmarshal_unmarshaler(t *testing.T) {
+	var s upperString
+	if err := Unmarshal([]byte{0x81, 0x61}, &s); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if s != "A" {
+		t.Errorf("Unmarshal() = %q, want %q", s, "A")
+	}
+
+	var v struct {
+		Name upperString
+		Node Node
+	}
+	data := []byte{
+		0xA2,
+		0x84, 0x6E, 0x61, 0x6D, 0x65, 0x81, 0x62,
+		0x84, 0x6E, 0x6F, 0x64, 0x65, 0xB3, 0x4E, 0x01, 0x90, 0xA0,
+	}
+	if err := Unmarshal(data, &v); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if v.Name != "B" || v.Node.ID != 1 {
+		t.Errorf("Unmarshal() = %#v", v)
+	}
+
+	dec := NewDecoder(bytes.NewReader([]byte{0x81, 0x61, 0xB1, 0x44, 0x01}))
+	var d Date
+	if err := dec.Decode(&s); err != nil {
+		t.Fatalf("Decoder.Decode() error = %v", err)
+	}
+	if err := dec.Decode(&d); err != nil {
+		t.Fatalf("Decoder.Decode() error = %v", err)
+	}
+	if d.Days != 1 {
+		t.Errorf("Decoder.Decode() = %#v, want %#v", d, Date{Days: 1})
+	}
+	if err := dec.Decode(&d); err != io.EOF {
+		t.Errorf("Decoder.Decode() error = %v, want %v", err, io.EOF)
+	}
+}
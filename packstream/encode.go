@@ -5,89 +5,343 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"time"
 )
 
+// encoder always writes to a buffer, whose writes never fail, so their errors
+// are not checked.
 type encoder struct {
-	buf *bytes.Buffer
+	w       *bytes.Buffer
+	scratch [8]byte
+	// utcDateTime selects the UTC based DateTime structures of Bolt 5.0.
+	utcDateTime bool
+	// elementIDs selects the graph structures with element IDs of Bolt 5.0.
+	elementIDs bool
 }
 
+// Marshaller is implemented by types that can encode themselves as a
+// packstream value. Marshal and Encoder.Encode use MarshalPackstream in
+// place of reflection, including for struct fields and elements that only
+// implement it on their pointer type.
 type Marshaller interface {
 	MarshalPackstream() ([]byte, error)
 }
 
+// packstreamEncoder is implemented by the types in this package so that they
+// can write directly to the encoder rather than allocating their own buffer
+// in MarshalPackstream.
+type packstreamEncoder interface {
+	encodePackstream(e *encoder) error
+}
+
 func Marshal(v interface{}) ([]byte, error) {
-	e := encoder{buf: new(bytes.Buffer)}
+	buf := new(bytes.Buffer)
+	e := encoder{w: buf}
 
 	err := e.marshal(v)
 	if err != nil {
 		return nil, err
 	}
 
-	return e.buf.Bytes(), nil
+	return buf.Bytes(), nil
+}
+
+// An Encoder writes packstream values to an output stream.
+type Encoder struct {
+	w   io.Writer
+	buf bytes.Buffer
+	e   encoder
+}
+
+// NewEncoder returns a new encoder that writes to w.
+//
+// Each value is encoded in full in memory before being written, trading the
+// memory of its encoding for never leaving a partial value on the stream. w
+// therefore does not need to be buffered.
+func NewEncoder(w io.Writer) *Encoder {
+	enc := &Encoder{w: w}
+	enc.e.w = &enc.buf
+
+	return enc
+}
+
+// SetUTCDateTime controls whether DateTime and DateTimeZoneID values are
+// written using the UTC based structures introduced in Bolt 5.0 (tags 0x49
+// and 0x69) instead of the legacy ones (tags 0x46 and 0x66). Converting a
+// DateTimeZoneID requires its time zone to be known to the time package.
+func (enc *Encoder) SetUTCDateTime(utc bool) {
+	enc.e.utcDateTime = utc
+}
+
+// SetElementIDs controls whether Node, Relationship and UnboundRelationship
+// values are written with the element ID fields introduced in Bolt 5.0.
+func (enc *Encoder) SetElementIDs(ids bool) {
+	enc.e.elementIDs = ids
+}
+
+// Encode writes the packstream encoding of v to the stream with a single
+// Write. Nothing is written if encoding fails.
+func (enc *Encoder) Encode(v interface{}) error {
+	defer enc.buf.Reset()
+
+	if err := enc.e.marshal(v); err != nil {
+		return err
+	}
+
+	_, err := enc.w.Write(enc.buf.Bytes())
+	return err
 }
 
-func (e encoder) marshal(v interface{}) error {
+func (e *encoder) marshal(v interface{}) error {
 	var err error
 
 	switch val := v.(type) {
 	case nil:
-		e.buf.WriteByte(0xC0)
+		e.w.WriteByte(0xC0)
 	case bool:
-		encodeBool(e.buf, val)
+		e.encodeBool(val)
 	case *bool:
-		encodeBool(e.buf, *val)
+		if val == nil {
+			e.w.WriteByte(0xC0)
+		} else {
+			e.encodeBool(*val)
+		}
 	case []byte:
-		encodeBytes(e.buf, val)
+		err = e.encodeBytes(val)
 	case string:
-		err = encodeString(e.buf, val)
+		err = e.encodeString(val)
 	case *string:
-		err = encodeString(e.buf, *val)
+		if val == nil {
+			e.w.WriteByte(0xC0)
+		} else {
+			err = e.encodeString(*val)
+		}
 	case int:
-		err = encodeInt(e.buf, val)
+		err = e.encodeInt(val)
 	case int8:
-		err = encodeInt(e.buf, int(val))
+		err = e.encodeInt(int(val))
 	case int16:
-		err = encodeInt(e.buf, int(val))
+		err = e.encodeInt(int(val))
 	case int32:
-		err = encodeInt(e.buf, int(val))
+		err = e.encodeInt(int(val))
 	case int64:
-		err = encodeInt(e.buf, int(val))
+		err = e.encodeInt(int(val))
 	case float32:
-		err = encodeFloat(e.buf, float64(val))
+		err = e.encodeFloat(float64(val))
 	case float64:
-		err = encodeFloat(e.buf, val)
+		err = e.encodeFloat(val)
+	case packstreamEncoder:
+		if isNilPointer(val) {
+			e.w.WriteByte(0xC0)
+		} else {
+			err = val.encodePackstream(e)
+		}
 	case Marshaller:
-		err = encodeMarshaller(e.buf, val)
+		if isNilPointer(val) {
+			e.w.WriteByte(0xC0)
+		} else {
+			err = e.encodeMarshaller(val)
+		}
 	default:
-		err = fmt.Errorf("unable to marshal value of type %T", v)
+		err = e.marshalValue(reflect.ValueOf(v))
 	}
 
 	return err
 }
 
-func encodeBool(buf *bytes.Buffer, v bool) {
+// isNilPointer reports whether v holds a nil pointer, which is encoded as
+// null rather than passed to its methods.
+func isNilPointer(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// marshalValue encodes values of types without a direct packstream
+// counterpart using reflection. Slices and arrays become Lists while maps
+// with string keys and structs become Dictionaries. Struct fields are named
+// after the packstream struct tag if present, otherwise the field name.
+// time.Time values become DateTimes in their own time zone offset.
+func (e *encoder) marshalValue(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		e.encodeBool(v.Bool())
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return e.encodeInt(int(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return fmt.Errorf("cannot encode unsigned integer %d greater than 9,223,372,036,854,775,807", v.Uint())
+		}
+		return e.encodeInt(int(v.Uint()))
+	case reflect.Float32, reflect.Float64:
+		return e.encodeFloat(v.Float())
+	case reflect.String:
+		return e.encodeString(v.String())
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.w.WriteByte(0xC0)
+			return nil
+		}
+		return e.marshalElem(v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.w.WriteByte(0xC0)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return e.encodeBytes(v.Bytes())
+		}
+		return e.marshalList(v)
+	case reflect.Array:
+		return e.marshalList(v)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		if v.IsNil() {
+			e.w.WriteByte(0xC0)
+			return nil
+		}
+		return e.marshalMap(v)
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return DateTimeOf(v.Interface().(time.Time)).encodePackstream(e)
+		}
+		return e.marshalStruct(v)
+	}
+
+	return fmt.Errorf("unable to marshal value of type %s", v.Type())
+}
+
+// marshalElem encodes a value reached through reflection, preferring the
+// direct encodings in marshal where the value is accessible. Addressable
+// values stay addressable so that methods on their pointer type are found
+// in nested values too.
+func (e *encoder) marshalElem(v reflect.Value) error {
+	if v.CanAddr() && v.Addr().CanInterface() {
+		switch p := v.Addr().Interface().(type) {
+		case packstreamEncoder:
+			return p.encodePackstream(e)
+		case Marshaller:
+			return e.encodeMarshaller(p)
+		}
+		return e.marshalValue(v)
+	}
+	if v.CanInterface() {
+		return e.marshal(v.Interface())
+	}
+
+	return e.marshalValue(v)
+}
+
+func (e *encoder) marshalList(v reflect.Value) error {
+	if err := writeListHeader(e, v.Len()); err != nil {
+		return err
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		if err := e.marshalElem(v.Index(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *encoder) marshalMap(v reflect.Value) error {
+	if err := writeDictionaryHeader(e, v.Len()); err != nil {
+		return err
+	}
+
+	iter := v.MapRange()
+	for iter.Next() {
+		if err := e.encodeString(iter.Key().String()); err != nil {
+			return err
+		}
+
+		if err := e.marshalElem(iter.Value()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *encoder) marshalStruct(v reflect.Value) error {
+	fields := cachedFields(v.Type())
+
+	// The Dictionary size precedes the entries, so omitted fields have to be
+	// filtered out before anything is written.
+	names := make([]string, 0, len(fields))
+	values := make([]reflect.Value, 0, len(fields))
+	for _, f := range fields {
+		fv := fieldByIndex(v, f.index)
+		if !fv.IsValid() || (f.omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+
+		names = append(names, f.name)
+		values = append(values, fv)
+	}
+
+	if err := writeDictionaryHeader(e, len(values)); err != nil {
+		return err
+	}
+
+	for i, fv := range values {
+		if err := e.encodeString(names[i]); err != nil {
+			return err
+		}
+
+		if err := e.marshalElem(fv); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeHeader writes a marker followed by a big endian size of n bytes.
+func (e *encoder) writeHeader(marker byte, size int, n int) {
+	e.w.WriteByte(marker)
+
+	switch n {
+	case 1:
+		e.w.WriteByte(byte(size))
+	case 2:
+		binary.BigEndian.PutUint16(e.scratch[:2], uint16(size))
+		e.w.Write(e.scratch[:2])
+	case 4:
+		binary.BigEndian.PutUint32(e.scratch[:4], uint32(size))
+		e.w.Write(e.scratch[:4])
+	}
+}
+
+func (e *encoder) encodeBool(v bool) {
 	if v {
-		buf.WriteByte(0xC3)
+		e.w.WriteByte(0xC3)
 	} else {
-		buf.WriteByte(0xC2)
+		e.w.WriteByte(0xC2)
 	}
 }
 
-func encodeBytes(buf *bytes.Buffer, v []byte) error {
+func (e *encoder) encodeBytes(v []byte) error {
 	if len(v) < (1 << 8) {
-		buf.WriteByte(0xCC)
-		buf.WriteByte(byte(len(v)))
+		e.writeHeader(0xCC, len(v), 1)
 	} else if len(v) < (1 << 16) {
-		buf.WriteByte(0xCD)
-		binary.Write(buf, binary.BigEndian, uint16(len(v)))
+		e.writeHeader(0xCD, len(v), 2)
 	} else if len(v) < (1 << 32) {
-		buf.WriteByte(0xCE)
-		binary.Write(buf, binary.BigEndian, uint32(len(v)))
+		e.writeHeader(0xCE, len(v), 4)
 	} else {
 		return errors.New("cannot encode byte slices of length greater than 2,147,483,647 bytes")
 	}
 
-	buf.Write(v)
+	e.w.Write(v)
 
 	return nil
 }
@@ -103,21 +357,24 @@ func encodeBytes(buf *bytes.Buffer, v []byte) error {
 // 	+128                            +32_767                     INT_16
 // 	+32_768                         +2_147_483_647              INT_32
 // 	+2_147_483_648                  +9_223_372_036_854_775_807  INT_64
-func encodeInt(buf *bytes.Buffer, v int) error {
+func (e *encoder) encodeInt(v int) error {
 	if -16 <= v && v <= 127 { // TINY_INT
-		buf.WriteByte(byte(v))
+		e.w.WriteByte(byte(v))
 	} else if -128 <= v && v <= -17 { // INT_8
-		buf.WriteByte(0xC8)
-		binary.Write(buf, binary.BigEndian, byte(v))
+		e.w.WriteByte(0xC8)
+		e.w.WriteByte(byte(v))
 	} else if -32_768 <= v && v <= 32_767 { // INT_16
-		buf.WriteByte(0xC9)
-		binary.Write(buf, binary.BigEndian, int16(v))
+		e.w.WriteByte(0xC9)
+		binary.BigEndian.PutUint16(e.scratch[:2], uint16(v))
+		e.w.Write(e.scratch[:2])
 	} else if -2_147_483_648 <= v && v <= 2_147_483_647 { // INT_32
-		buf.WriteByte(0xCA)
-		binary.Write(buf, binary.BigEndian, int32(v))
+		e.w.WriteByte(0xCA)
+		binary.BigEndian.PutUint32(e.scratch[:4], uint32(v))
+		e.w.Write(e.scratch[:4])
 	} else if -9_223_372_036_854_775_808 <= v && v <= 9_223_372_036_854_775_807 { // INT_64
-		buf.WriteByte(0xCB)
-		binary.Write(buf, binary.BigEndian, int64(v))
+		e.w.WriteByte(0xCB)
+		binary.BigEndian.PutUint64(e.scratch[:], uint64(v))
+		e.w.Write(e.scratch[:])
 	} else {
 		return errors.New("unable to encode int")
 	}
@@ -125,9 +382,10 @@ func encodeInt(buf *bytes.Buffer, v int) error {
 	return nil
 }
 
-func encodeFloat(buf *bytes.Buffer, v float64) error {
-	buf.WriteByte(0xC1)
-	binary.Write(buf, binary.BigEndian, v)
+func (e *encoder) encodeFloat(v float64) error {
+	e.w.WriteByte(0xC1)
+	binary.BigEndian.PutUint64(e.scratch[:], math.Float64bits(v))
+	e.w.Write(e.scratch[:])
 
 	return nil
 }
@@ -141,34 +399,31 @@ var shortStringMarkers = [16]byte{
 	0x8C, 0x8D, 0x8E, 0x8F,
 }
 
-func encodeString(buf *bytes.Buffer, v string) error {
+func (e *encoder) encodeString(v string) error {
 	if len(v) < (1 << 4) {
-		buf.WriteByte(shortStringMarkers[len(v)])
+		e.w.WriteByte(shortStringMarkers[len(v)])
 	} else if len(v) < (1 << 8) {
-		buf.WriteByte(0xD0)
-		buf.WriteByte(byte(len(v)))
+		e.writeHeader(0xD0, len(v), 1)
 	} else if len(v) < (1 << 16) {
-		buf.WriteByte(0xD1)
-		binary.Write(buf, binary.BigEndian, uint16(len(v)))
+		e.writeHeader(0xD1, len(v), 2)
 	} else if len(v) < (1 << 32) {
-		buf.WriteByte(0xD2)
-		binary.Write(buf, binary.BigEndian, uint32(len(v)))
+		e.writeHeader(0xD2, len(v), 4)
 	} else {
 		return errors.New("cannot encode string of length greater than 2,147,483,647 bytes")
 	}
 
-	buf.Write([]byte(v))
+	io.WriteString(e.w, v)
 
 	return nil
 }
 
-func encodeMarshaller(buf *bytes.Buffer, v Marshaller) error {
+func (e *encoder) encodeMarshaller(v Marshaller) error {
 	b, err := v.MarshalPackstream()
 	if err != nil {
 		return err
 	}
 
-	buf.Write(b)
+	e.w.Write(b)
 
 	return nil
 }
@@ -1,84 +1,74 @@
 package packstream
 
 import (
+	"bytes"
+	"io"
+	"math"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
-func TestMarshal(t *testing.T) {
-	type args struct {
-		v interface{}
-	}
-	tests := []struct {
-		name    string
-		args    args
-		want    []byte
-		wantErr bool
-	}{
-		{
-			name:    "null",
-			args:    args{v: nil},
-			want:    []byte{0xC0},
-			wantErr: false,
-		},
-		{
-			name:    "false",
-			args:    args{v: false},
-			want:    []byte{0xC2},
-			wantErr: false,
-		},
-		{
-			name:    "true",
-			args:    args{v: true},
-			want:    []byte{0xC3},
-			wantErr: false,
-		},
-		{
-			name:    "bool ponter",
-			args:    args{v: boolPtr(true)},
-			want:    []byte{0xC3},
-			wantErr: false,
-		},
-		{
-			name:    "empty byte slice",
-			args:    args{v: []byte{}},
-			want:    []byte{0xCC, 0x00},
-			wantErr: false,
-		},
-		{
-			name:    "empty byte slice",
-			args:    args{v: []byte{}},
-			want:    []byte{0xCC, 0x00},
-			wantErr: false,
-		},
-		{
-			name:    "8 bit byte slice",
-			args:    args{v: []byte{0x61, 0x62, 0x63}},
-			want:    []byte{0xCC, 0x03, 0x61, 0x62, 0x63},
-			wantErr: false,
-		},
-		{
-			name: "16 bit byte slice",
-			args: args{
-				v: []byte{
-					0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50,
-					0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
-					0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42,
-					0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55,
-					0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E,
-					0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47,
-					0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A,
-					0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53,
-					0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C,
-					0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45,
-					0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
-					0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51,
-					0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A,
-					0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A,
-				},
-			},
-			want: []byte{
-				0xCD, 0x01, 0x04, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50,
+type marshalArgs struct {
+	v interface{}
+}
+
+// marshalTests is shared with the Unmarshal tests to verify that decoding is
+// symmetric with encoding.
+var marshalTests = []struct {
+	name    string
+	args    marshalArgs
+	want    []byte
+	wantErr bool
+}{
+	{
+		name:    "null",
+		args:    marshalArgs{v: nil},
+		want:    []byte{0xC0},
+		wantErr: false,
+	},
+	{
+		name:    "false",
+		args:    marshalArgs{v: false},
+		want:    []byte{0xC2},
+		wantErr: false,
+	},
+	{
+		name:    "true",
+		args:    marshalArgs{v: true},
+		want:    []byte{0xC3},
+		wantErr: false,
+	},
+	{
+		name:    "bool ponter",
+		args:    marshalArgs{v: boolPtr(true)},
+		want:    []byte{0xC3},
+		wantErr: false,
+	},
+	{
+		name:    "empty byte slice",
+		args:    marshalArgs{v: []byte{}},
+		want:    []byte{0xCC, 0x00},
+		wantErr: false,
+	},
+	{
+		name:    "empty byte slice",
+		args:    marshalArgs{v: []byte{}},
+		want:    []byte{0xCC, 0x00},
+		wantErr: false,
+	},
+	{
+		name:    "8 bit byte slice",
+		args:    marshalArgs{v: []byte{0x61, 0x62, 0x63}},
+		want:    []byte{0xCC, 0x03, 0x61, 0x62, 0x63},
+		wantErr: false,
+	},
+	{
+		name: "16 bit byte slice",
+		args: marshalArgs{
+			v: []byte{
+				0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50,
 				0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
 				0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42,
 				0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55,
@@ -93,181 +83,605 @@ func TestMarshal(t *testing.T) {
 				0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A,
 				0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A,
 			},
-			wantErr: false,
 		},
-		{
-			name:    "empty string",
-			args:    args{v: ""},
-			want:    []byte{0x80},
-			wantErr: false,
+		want: []byte{
+			0xCD, 0x01, 0x04, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50,
+			0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+			0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42,
+			0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55,
+			0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E,
+			0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47,
+			0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A,
+			0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53,
+			0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C,
+			0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45,
+			0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+			0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51,
+			0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A,
+			0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A,
 		},
-		{
-			name:    "short string",
-			args:    args{v: "abc"},
-			want:    []byte{0x83, 0x61, 0x62, 0x63},
-			wantErr: false,
+		wantErr: false,
+	},
+	{
+		name:    "empty string",
+		args:    marshalArgs{v: ""},
+		want:    []byte{0x80},
+		wantErr: false,
+	},
+	{
+		name:    "short string",
+		args:    marshalArgs{v: "abc"},
+		want:    []byte{0x83, 0x61, 0x62, 0x63},
+		wantErr: false,
+	},
+	{
+		name:    "max length short string",
+		args:    marshalArgs{v: "abcabcabcabcabc"},
+		want:    []byte{0x8F, 0x61, 0x62, 0x63, 0x61, 0x62, 0x63, 0x61, 0x62, 0x63, 0x61, 0x62, 0x63, 0x61, 0x62, 0x63},
+		wantErr: false,
+	},
+	{
+		name: "8 bit string",
+		args: marshalArgs{v: "ABCDEFGHIJKLMNOPQRSTUVWXYZ"},
+		want: []byte{
+			0xD0, 0x1A, 0x41, 0x42, 0x43, 0x44,
+			0x45, 0x46, 0x47, 0x48, 0x49, 0x4A,
+			0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50,
+			0x51, 0x52, 0x53, 0x54, 0x55, 0x56,
+			0x57, 0x58, 0x59, 0x5A,
 		},
+		wantErr: false,
+	},
+	{
+		name: "16 bit string",
+		args: marshalArgs{v: "ABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKLMNOPQRSTUVWXYZ"},
+		want: []byte{
+			0xD1, 0x01, 0x04, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50,
+			0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+			0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42,
+			0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55,
+			0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E,
+			0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47,
+			0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A,
+			0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53,
+			0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C,
+			0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45,
+			0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+			0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51,
+			0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A,
+			0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A,
+		},
+		wantErr: false,
+	},
+	{
+		name:    "string pointer",
+		args:    marshalArgs{v: strPtr("")},
+		want:    []byte{0x80},
+		wantErr: false,
+	},
+	{
+		name:    "tiny int min",
+		args:    marshalArgs{v: -16},
+		want:    []byte{0xF0},
+		wantErr: false,
+	},
+	{
+		name:    "tiny int max",
+		args:    marshalArgs{v: 127},
+		want:    []byte{0x7F},
+		wantErr: false,
+	},
+	{
+		name:    "negative 8 bit int min",
+		args:    marshalArgs{v: -128},
+		want:    []byte{0xC8, 0x80},
+		wantErr: false,
+	},
+	{
+		name:    "negative 8 bit int max",
+		args:    marshalArgs{v: -17},
+		want:    []byte{0xC8, 0xEF},
+		wantErr: false,
+	},
+	{
+		name:    "positive 16 bit int min",
+		args:    marshalArgs{v: 128},
+		want:    []byte{0xC9, 0x00, 0x80},
+		wantErr: false,
+	},
+	{
+		name:    "positive 16 bit int max",
+		args:    marshalArgs{v: 32_767},
+		want:    []byte{0xC9, 0x7F, 0xFF},
+		wantErr: false,
+	},
+	{
+		name:    "negative 16 bit int min",
+		args:    marshalArgs{v: -32_768},
+		want:    []byte{0xC9, 0x80, 0x00},
+		wantErr: false,
+	},
+	{
+		name:    "negative 16 bit int max",
+		args:    marshalArgs{v: -129},
+		want:    []byte{0xC9, 0xff, 0x7f},
+		wantErr: false,
+	},
+	{
+		name:    "positive 32 bit int min",
+		args:    marshalArgs{v: 32_768},
+		want:    []byte{0xCA, 0x00, 0x00, 0x80, 0x00},
+		wantErr: false,
+	},
+	{
+		name:    "positive 32 bit int max",
+		args:    marshalArgs{v: 2_147_483_647},
+		want:    []byte{0xCA, 0x7F, 0xFF, 0xFF, 0xFF},
+		wantErr: false,
+	},
+	{
+		name:    "negative 32 bit int min",
+		args:    marshalArgs{v: -2_147_483_648},
+		want:    []byte{0xCA, 0x80, 0x00, 0x00, 0x00},
+		wantErr: false,
+	},
+	{
+		name:    "negative 32 bit int max",
+		args:    marshalArgs{v: -32_769},
+		want:    []byte{0xCA, 0xFF, 0xFF, 0x7F, 0xFF},
+		wantErr: false,
+	},
+	{
+		name:    "positive 64 bit int min",
+		args:    marshalArgs{v: 2_147_483_648},
+		want:    []byte{0xCB, 0x00, 0x00, 0x00, 0x00, 0x80, 0x00, 0x00, 0x00},
+		wantErr: false,
+	},
+	{
+		name:    "positive 64 bit int max",
+		args:    marshalArgs{v: 9_223_372_036_854_775_807},
+		want:    []byte{0xCB, 0x7F, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+		wantErr: false,
+	},
+	{
+		name:    "negative 64 bit int min",
+		args:    marshalArgs{v: -9_223_372_036_854_775_808},
+		want:    []byte{0xCB, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		wantErr: false,
+	},
+	{
+		name:    "negative 64 bit int max",
+		args:    marshalArgs{v: -2_147_483_649},
+		want:    []byte{0xCB, 0xFF, 0xFF, 0xFF, 0xFF, 0x7F, 0xFF, 0xFF, 0xFF},
+		wantErr: false,
+	},
+	{
+		name:    "float",
+		args:    marshalArgs{v: 1.23},
+		want:    []byte{0xC1, 0x3F, 0xF3, 0xAE, 0x14, 0x7A, 0xE1, 0x47, 0xAE},
+		wantErr: false,
+	},
+	{
+		name:    "node",
+		args:    marshalArgs{v: Node{ID: 1, Labels: List{"A"}, Properties: Dictionary{}}},
+		want:    []byte{0xB3, 0x4E, 0x01, 0x91, 0x81, 0x41, 0xA0},
+		wantErr: false,
+	},
+	{
+		name:    "date",
+		args:    marshalArgs{v: Date{Days: 128}},
+		want:    []byte{0xB1, 0x44, 0xC9, 0x00, 0x80},
+		wantErr: false,
+	},
+	{
+		name:    "raw structure",
+		args:    marshalArgs{v: RawStructure{Signature: 0x7A, Fields: List{int64(1), "a"}}},
+		want:    []byte{0xB2, 0x7A, 0x01, 0x81, 0x61},
+		wantErr: false,
+	},
+	{
+		name:    "raw structure with 15 fields",
+		args:    marshalArgs{v: RawStructure{Signature: 0x7A, Fields: make(List, 15)}},
+		want:    append([]byte{0xBF, 0x7A}, bytes.Repeat([]byte{0xC0}, 15)...),
+		wantErr: false,
+	},
+	{
+		name:    "raw structure with 16 fields",
+		args:    marshalArgs{v: RawStructure{Signature: 0x7A, Fields: make(List, 16)}},
+		want:    nil,
+		wantErr: true,
+	},
+}
+
+func TestMarshal(t *testing.T) {
+	for _, tt := range marshalTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Marshal(tt.args.v)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Marshal() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Marshal() = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshal_struct(t *testing.T) {
+	type Embedded struct {
+		C string
+		D string
+	}
+
+	type person struct {
+		Embedded
+		A       int    `packstream:"a"`
+		B       string `packstream:"b,omitempty"`
+		D       string
+		Skipped bool `packstream:"-"`
+		private int
+	}
+
+	type namedInt int
+	type namedList []namedString
+	type event struct {
+		At time.Time `packstream:"at"`
+	}
+
+	// 2024-05-01T12:00:00.000000005+02:00
+	at := time.Date(2024, 5, 1, 12, 0, 0, 5, time.FixedZone("", 7_200))
+	dateTime := []byte{0xB3, 0x46, 0xCA, 0x66, 0x32, 0x2E, 0xC0, 0x05, 0xC9, 0x1C, 0x20}
+
+	tests := []struct {
+		name    string
+		v       interface{}
+		want    []byte
+		wantErr bool
+	}{
 		{
-			name:    "max length short string",
-			args:    args{v: "abcabcabcabcabc"},
-			want:    []byte{0x8F, 0x61, 0x62, 0x63, 0x61, 0x62, 0x63, 0x61, 0x62, 0x63, 0x61, 0x62, 0x63, 0x61, 0x62, 0x63},
-			wantErr: false,
+			name: "omitted empty field",
+			v:    person{A: 1},
+			want: []byte{
+				0xA3,
+				0x81, 0x61, 0x01,
+				0x81, 0x44, 0x80,
+				0x81, 0x43, 0x80,
+			},
 		},
 		{
-			name: "8 bit string",
-			args: args{v: "ABCDEFGHIJKLMNOPQRSTUVWXYZ"},
+			name: "all fields",
+			v:    person{Embedded: Embedded{C: "c", D: "x"}, A: 1, B: "b", D: "d"},
 			want: []byte{
-				0xD0, 0x1A, 0x41, 0x42, 0x43, 0x44,
-				0x45, 0x46, 0x47, 0x48, 0x49, 0x4A,
-				0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50,
-				0x51, 0x52, 0x53, 0x54, 0x55, 0x56,
-				0x57, 0x58, 0x59, 0x5A,
+				0xA4,
+				0x81, 0x61, 0x01,
+				0x81, 0x62, 0x81, 0x62,
+				0x81, 0x44, 0x81, 0x64,
+				0x81, 0x43, 0x81, 0x63,
 			},
-			wantErr: false,
 		},
 		{
-			name: "16 bit string",
-			args: args{v: "ABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKLMNOPQRSTUVWXYZ"},
+			name: "pointer to struct",
+			v:    &person{A: 1},
 			want: []byte{
-				0xD1, 0x01, 0x04, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50,
-				0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
-				0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42,
-				0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55,
-				0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E,
-				0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47,
-				0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A,
-				0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53,
-				0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C,
-				0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45,
-				0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
-				0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51,
-				0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49, 0x4A,
-				0x4B, 0x4C, 0x4D, 0x4E, 0x4F, 0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5A,
+				0xA3,
+				0x81, 0x61, 0x01,
+				0x81, 0x44, 0x80,
+				0x81, 0x43, 0x80,
 			},
-			wantErr: false,
 		},
 		{
-			name:    "string pointer",
-			args:    args{v: strPtr("")},
-			want:    []byte{0x80},
-			wantErr: false,
+			name: "slice",
+			v:    []int{1, 2},
+			want: []byte{0x92, 0x01, 0x02},
 		},
 		{
-			name:    "tiny int min",
-			args:    args{v: -16},
-			want:    []byte{0xF0},
-			wantErr: false,
+			name: "nil slice",
+			v:    []string(nil),
+			want: []byte{0xC0},
 		},
 		{
-			name:    "tiny int max",
-			args:    args{v: 127},
-			want:    []byte{0x7F},
-			wantErr: false,
+			name: "array",
+			v:    [2]bool{true, false},
+			want: []byte{0x92, 0xC3, 0xC2},
 		},
 		{
-			name:    "negative 8 bit int min",
-			args:    args{v: -128},
-			want:    []byte{0xC8, 0x80},
-			wantErr: false,
+			name: "map with string keys",
+			v:    map[string]uint8{"a": 1},
+			want: []byte{0xA1, 0x81, 0x61, 0x01},
 		},
 		{
-			name:    "negative 8 bit int max",
-			args:    args{v: -17},
-			want:    []byte{0xC8, 0xEF},
-			wantErr: false,
+			name: "unsigned int",
+			v:    uint64(math.MaxInt64),
+			want: []byte{0xCB, 0x7F, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
 		},
 		{
-			name:    "positive 16 bit int min",
-			args:    args{v: 128},
-			want:    []byte{0xC9, 0x00, 0x80},
-			wantErr: false,
+			name:    "unsigned int overflow",
+			v:       uint64(math.MaxInt64) + 1,
+			wantErr: true,
 		},
 		{
-			name:    "positive 16 bit int max",
-			args:    args{v: 32_767},
-			want:    []byte{0xC9, 0x7F, 0xFF},
-			wantErr: false,
+			name:    "map with non-string keys",
+			v:       map[int]string{1: "a"},
+			wantErr: true,
 		},
 		{
-			name:    "negative 16 bit int min",
-			args:    args{v: -32_768},
-			want:    []byte{0xC9, 0x80, 0x00},
-			wantErr: false,
+			name: "named string",
+			v:    namedString("a"),
+			want: []byte{0x81, 0x61},
 		},
 		{
-			name:    "negative 16 bit int max",
-			args:    args{v: -129},
-			want:    []byte{0xC9, 0xff, 0x7f},
-			wantErr: false,
+			name: "named int",
+			v:    namedInt(-1),
+			want: []byte{0xFF},
 		},
 		{
-			name:    "positive 32 bit int min",
-			args:    args{v: 32_768},
-			want:    []byte{0xCA, 0x00, 0x00, 0x80, 0x00},
-			wantErr: false,
+			name: "named slice of named strings",
+			v:    namedList{"a"},
+			want: []byte{0x91, 0x81, 0x61},
 		},
 		{
-			name:    "positive 32 bit int max",
-			args:    args{v: 2_147_483_647},
-			want:    []byte{0xCA, 0x7F, 0xFF, 0xFF, 0xFF},
-			wantErr: false,
+			name: "time",
+			v:    at,
+			want: dateTime,
 		},
 		{
-			name:    "negative 32 bit int min",
-			args:    args{v: -2_147_483_648},
-			want:    []byte{0xCA, 0x80, 0x00, 0x00, 0x00},
-			wantErr: false,
+			name: "time in map",
+			v:    map[string]interface{}{"at": at},
+			want: append([]byte{0xA1, 0x82, 0x61, 0x74}, dateTime...),
 		},
 		{
-			name:    "negative 32 bit int max",
-			args:    args{v: -32_769},
-			want:    []byte{0xCA, 0xFF, 0xFF, 0x7F, 0xFF},
-			wantErr: false,
+			name: "time struct field",
+			v:    &event{At: at},
+			want: append([]byte{0xA1, 0x82, 0x61, 0x74}, dateTime...),
 		},
 		{
-			name:    "positive 64 bit int min",
-			args:    args{v: 2_147_483_648},
-			want:    []byte{0xCB, 0x00, 0x00, 0x00, 0x00, 0x80, 0x00, 0x00, 0x00},
-			wantErr: false,
+			name: "time pointer",
+			v:    &at,
+			want: dateTime,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Marshal(tt.v)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Marshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Marshal() = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+// namedString is a string type without methods, shared with the Unmarshal
+// tests.
+type namedString string
+
+func strPtr(v string) *string { return &v }
+func boolPtr(v bool) *bool    { return &v }
+
+// nestedNodes builds a List of Lists of Nodes, each Node carrying a
+// Dictionary of properties, to measure the cost of nested containers.
+func nestedNodes() List {
+	outer := make(List, 10)
+	for i := range outer {
+		inner := make(List, 10)
+		for j := range inner {
+			inner[j] = Node{
+				ID:         i*10 + j,
+				Labels:     List{"Person"},
+				Properties: Dictionary{"name": "Alice", "age": 42, "tags": List{"a", "b"}},
+			}
+		}
+		outer[i] = Dictionary{"nodes": inner}
+	}
+
+	return outer
+}
+
+func BenchmarkMarshal_nestedNodes(b *testing.B) {
+	v := nestedNodes()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncoder_Encode_nestedNodes(b *testing.B) {
+	v := nestedNodes()
+	enc := NewEncoder(io.Discard)
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if err := enc.Encode(v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestEncoder_Encode(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+
+	for _, v := range []interface{}{true, List{1, "a"}, Date{Days: 128}} {
+		if err := enc.Encode(v); err != nil {
+			t.Fatalf("Encoder.Encode() error = %v", err)
+		}
+	}
+
+	if err := enc.Encode(List{1, make(chan int)}); err == nil {
+		t.Fatal("Encoder.Encode() expected error for unsupported type")
+	}
+
+	want := []byte{
+		0xC3,
+		0x92, 0x01, 0x81, 0x61,
+		0xB1, 0x44, 0xC9, 0x00, 0x80,
+	}
+	if !reflect.DeepEqual(buf.Bytes(), want) {
+		t.Errorf("Encoder.Encode() wrote %x, want %x", buf.Bytes(), want)
+	}
+}
+
+func TestEncoder_Encode_error(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf)
+
+	// The first element is larger than any write buffer, so it would reach
+	// the stream before the error if the encoder flushed as it went.
+	if err := enc.Encode(List{make([]byte, 1<<16), make(chan int)}); err == nil {
+		t.Fatal("Encoder.Encode() expected error for unsupported type")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Encoder.Encode() wrote %d bytes, want none", buf.Len())
+	}
+
+	if err := enc.Encode(true); err != nil {
+		t.Fatalf("Encoder.Encode() error = %v", err)
+	}
+	if want := []byte{0xC3}; !reflect.DeepEqual(buf.Bytes(), want) {
+		t.Errorf("Encoder.Encode() wrote %x, want %x", buf.Bytes(), want)
+	}
+}
+
+// ptrMarshaller implements Marshaller on its pointer type only.
+type ptrMarshaller struct {
+	v string
+}
+
+func (m *ptrMarshaller) MarshalPackstream() ([]byte, error) {
+	return Marshal(strings.ToUpper(m.v))
+}
+
+func TestEncoder_Encode_marshaller(t *testing.T) {
+	type wrapper struct {
+		M ptrMarshaller `packstream:"m"`
+	}
+	type nilWrapper struct {
+		P *ptrMarshaller `packstream:"p"`
+	}
+
+	tests := []struct {
+		name string
+		v    interface{}
+		want []byte
+	}{
+		{name: "pointer", v: &ptrMarshaller{v: "a"}, want: []byte{0x81, 0x41}},
+		{name: "struct field", v: &wrapper{M: ptrMarshaller{v: "a"}}, want: []byte{0xA1, 0x81, 0x6D, 0x81, 0x41}},
+		{name: "slice element", v: []ptrMarshaller{{v: "a"}, {v: "b"}}, want: []byte{0x92, 0x81, 0x41, 0x81, 0x42}},
+		{name: "nil pointer", v: (*ptrMarshaller)(nil), want: []byte{0xC0}},
+		{name: "nil pointer struct field", v: nilWrapper{}, want: []byte{0xA1, 0x81, 0x70, 0xC0}},
+		{name: "nil pointer addressable struct field", v: &nilWrapper{}, want: []byte{0xA1, 0x81, 0x70, 0xC0}},
+		{name: "nil pointer list element", v: List{(*ptrMarshaller)(nil)}, want: []byte{0x91, 0xC0}},
+		{name: "nil pointer slice element", v: []*ptrMarshaller{nil}, want: []byte{0x91, 0xC0}},
+		{name: "nil node list element", v: List{(*Node)(nil)}, want: []byte{0x91, 0xC0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			if err := NewEncoder(buf).Encode(tt.v); err != nil {
+				t.Fatalf("Encoder.Encode() error = %v", err)
+			}
+			if !reflect.DeepEqual(buf.Bytes(), tt.want) {
+				t.Errorf("Encoder.Encode() = %x, want %x", buf.Bytes(), tt.want)
+			}
+		})
+	}
+}
+
+func TestEncoder_SetUTCDateTime(t *testing.T) {
+	// 2020-06-01T12:00:00 wall clock time, which is UTC+2 in Stockholm.
+	const wall = 1_591_012_800
+
+	tests := []struct {
+		name string
+		v    Structure
+		want []byte
+	}{
+		{
+			name: "date time",
+			v:    DateTime{Seconds: wall, Nanoseconds: 0, TZOffsetSeconds: 7_200},
+			want: []byte{0xB3, 0x49, 0xCA, 0x5E, 0xD4, 0xD1, 0xA0, 0x00, 0xC9, 0x1C, 0x20},
 		},
 		{
-			name:    "positive 64 bit int max",
-			args:    args{v: 9_223_372_036_854_775_807},
-			want:    []byte{0xCB, 0x7F, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
-			wantErr: false,
+			name: "date time zone id",
+			v:    DateTimeZoneID{Seconds: wall, Nanoseconds: 0, TimeZoneID: "Europe/Stockholm"},
+			want: append([]byte{0xB3, 0x69, 0xCA, 0x5E, 0xD4, 0xD1, 0xA0, 0x00, 0xD0, 0x10}, "Europe/Stockholm"...),
 		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			enc := NewEncoder(buf)
+			enc.SetUTCDateTime(true)
+
+			if err := enc.Encode(tt.v); err != nil {
+				t.Fatalf("Encoder.Encode() error = %v", err)
+			}
+			if !reflect.DeepEqual(buf.Bytes(), tt.want) {
+				t.Errorf("Encoder.Encode() = %x, want %x", buf.Bytes(), tt.want)
+			}
+
+			var got interface{}
+			if err := Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.v) {
+				t.Errorf("Unmarshal() = %#v, want %#v", got, tt.v)
+			}
+		})
+	}
+}
+
+func TestEncoder_SetElementIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		v    Structure
+		want []byte
+	}{
 		{
-			name:    "negative 64 bit int min",
-			args:    args{v: -9_223_372_036_854_775_808},
-			want:    []byte{0xCB, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
-			wantErr: false,
+			name: "node",
+			v:    Node{ID: 1, Labels: List{}, Properties: Dictionary{}, ElementID: "n"},
+			want: []byte{0xB4, 0x4E, 0x01, 0x90, 0xA0, 0x81, 0x6E},
 		},
 		{
-			name:    "negative 64 bit int max",
-			args:    args{v: -2_147_483_649},
-			want:    []byte{0xCB, 0xFF, 0xFF, 0xFF, 0xFF, 0x7F, 0xFF, 0xFF, 0xFF},
-			wantErr: false,
+			name: "relationship",
+			v: Relationship{
+				ID: 1, StartNodeID: 2, EndNodeID: 3, Type: "R", Properties: Dictionary{},
+				ElementID: "r", StartNodeElementID: "a", EndNodeElementID: "b",
+			},
+			want: []byte{0xB8, 0x52, 0x01, 0x02, 0x03, 0x81, 0x52, 0xA0, 0x81, 0x72, 0x81, 0x61, 0x81, 0x62},
 		},
 		{
-			name:    "float",
-			args:    args{v: 1.23},
-			want:    []byte{0xC1, 0x3F, 0xF3, 0xAE, 0x14, 0x7A, 0xE1, 0x47, 0xAE},
-			wantErr: false,
+			name: "unbound relationship",
+			v:    UnboundRelationship{ID: 1, Type: "R", Properties: Dictionary{}, ElementID: "r"},
+			want: []byte{0xB4, 0x72, 0x01, 0x81, 0x52, 0xA0, 0x81, 0x72},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := Marshal(tt.args.v)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("Marshal() error = %v, wantErr %v", err, tt.wantErr)
-				return
+			buf := new(bytes.Buffer)
+			enc := NewEncoder(buf)
+			enc.SetElementIDs(true)
+
+			if err := enc.Encode(tt.v); err != nil {
+				t.Fatalf("Encoder.Encode() error = %v", err)
 			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("Marshal() = %x, want %x", got, tt.want)
+			if !reflect.DeepEqual(buf.Bytes(), tt.want) {
+				t.Errorf("Encoder.Encode() = %x, want %x", buf.Bytes(), tt.want)
+			}
+
+			var got interface{}
+			if err := Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.v) {
+				t.Errorf("Unmarshal() = %#v, want %#v", got, tt.v)
 			}
 		})
 	}
 }
-
-func strPtr(v string) *string { return &v }
-func boolPtr(v bool) *bool    { return &v }
@@ -0,0 +1,145 @@
+package packstream
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// field describes an exported struct field that maps to a Dictionary entry.
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// fieldCache maps a reflect.Type to its []field.
+var fieldCache sync.Map
+
+// cachedFields returns the fields of the struct type t that take part in
+// encoding and decoding.
+func cachedFields(t reflect.Type) []field {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.([]field)
+	}
+
+	f, _ := fieldCache.LoadOrStore(t, typeFields(t, nil, map[string]bool{}))
+	return f.([]field)
+}
+
+// typeFields collects the fields of t honoring the packstream struct tag. The
+// tag takes the form `packstream:"name,omitempty"` and a name of "-" skips the
+// field. Fields of untagged embedded structs are promoted into the parent,
+// with the fields of the outer struct taking precedence.
+func typeFields(t reflect.Type, index []int, seen map[string]bool) []field {
+	var fields []field
+	var embedded []reflect.StructField
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		tag := sf.Tag.Get("packstream")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, opts = tag[:i], tag[i+1:]
+		}
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			// Pointers to unexported structs cannot be allocated when
+			// decoding, so they are skipped entirely.
+			if sf.PkgPath == "" || sf.Type.Kind() != reflect.Ptr {
+				embedded = append(embedded, sf)
+			}
+			continue
+		}
+
+		if sf.PkgPath != "" { // unexported
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		fields = append(fields, field{
+			name:      name,
+			index:     append(append([]int{}, index...), i),
+			omitEmpty: opts == "omitempty",
+		})
+	}
+
+	for _, sf := range embedded {
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		fields = append(fields, typeFields(ft, append(append([]int{}, index...), sf.Index...), seen)...)
+	}
+
+	return fields
+}
+
+// fieldByIndex returns the nested field of v at index. Nil embedded pointers
+// are reported as invalid values.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+
+	return v
+}
+
+// fieldByIndexAlloc is like fieldByIndex but allocates nil embedded pointers
+// so that the field can be set.
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+
+	return v
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+
+	return false
+}
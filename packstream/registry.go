@@ -0,0 +1,77 @@
+package packstream
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[byte]func() Structure{
+		Node{}.Tag():                func() Structure { return new(Node) },
+		Relationship{}.Tag():        func() Structure { return new(Relationship) },
+		UnboundRelationship{}.Tag(): func() Structure { return new(UnboundRelationship) },
+		Path{}.Tag():                func() Structure { return new(Path) },
+		Date{}.Tag():                func() Structure { return new(Date) },
+		Time{}.Tag():                func() Structure { return new(Time) },
+		LocalTime{}.Tag():           func() Structure { return new(LocalTime) },
+		DateTime{}.Tag():            func() Structure { return new(DateTime) },
+		DateTimeZoneID{}.Tag():      func() Structure { return new(DateTimeZoneID) },
+		dateTimeUTCTag:              func() Structure { return new(DateTime) },
+		dateTimeZoneIDUTCTag:        func() Structure { return new(DateTimeZoneID) },
+		LocalDateTime{}.Tag():       func() Structure { return new(LocalDateTime) },
+		Duration{}.Tag():            func() Structure { return new(Duration) },
+		Point2D{}.Tag():             func() Structure { return new(Point2D) },
+		Point3D{}.Tag():             func() Structure { return new(Point3D) },
+	}
+)
+
+// RegisterStructure makes the decoder materialize structures with the given
+// tag using the values returned by factory, replacing any type previously
+// registered for the tag. The factory must return a pointer implementing
+// Unmarshaler, which is used to decode the structure. When decoding into an
+// empty interface, the pointed to value is stored rather than the pointer.
+//
+// Structures with a tag that has no registered type are decoded into a
+// RawStructure.
+//
+// RegisterStructure panics if factory is nil or its values do not implement
+// Unmarshaler.
+func RegisterStructure(tag byte, factory func() Structure) {
+	if factory == nil {
+		panic("packstream: RegisterStructure factory is nil")
+	}
+	if _, ok := factory().(Unmarshaler); !ok {
+		panic(fmt.Sprintf("packstream: RegisterStructure factory for tag 0x%02X does not return an Unmarshaler", tag))
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	registry[tag] = factory
+}
+
+// lookupStructure returns a new value for the structure type registered
+// with tag, or nil if there is none.
+func lookupStructure(tag byte) Unmarshaler {
+	registryMu.RLock()
+	factory, ok := registry[tag]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	return factory().(Unmarshaler)
+}
+
+// derefStructure returns the value pointed to by s, since structures are
+// stored by value to match how they are encoded.
+func derefStructure(s Unmarshaler) interface{} {
+	if v := reflect.ValueOf(s); v.Kind() == reflect.Ptr {
+		return v.Elem().Interface()
+	}
+
+	return s
+}
@@ -0,0 +1,77 @@
+package packstream
+
+import (
+	"reflect"
+	"testing"
+)
+
+// elementNode is a vendor-specific Node variant identified by element ID.
+type elementNode struct {
+	ElementID string
+	Labels    List
+}
+
+func (elementNode) Tag() byte        { return 0x01 }
+func (elementNode) FieldCount() uint { return 2 }
+
+func (n *elementNode) UnmarshalPackstream(data []byte) error {
+	return unmarshalStructure(data, n, &n.ElementID, &n.Labels)
+}
+
+func TestRegisterStructure(t *testing.T) {
+	data := []byte{0x91, 0xB2, 0x01, 0x81, 0x61, 0x91, 0x81, 0x41}
+
+	var got interface{}
+	if err := Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	want := List{RawStructure{Signature: 0x01, Fields: List{"a", List{"A"}}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unmarshal() before registering = %#v, want %#v", got, want)
+	}
+
+	RegisterStructure(0x01, func() Structure { return new(elementNode) })
+	defer func() {
+		registryMu.Lock()
+		delete(registry, 0x01)
+		registryMu.Unlock()
+	}()
+
+	if err := Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	want = List{elementNode{ElementID: "a", Labels: List{"A"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unmarshal() after registering = %#v, want %#v", got, want)
+	}
+
+	// RawStructure bypasses the registry.
+	var raw RawStructure
+	if err := Unmarshal(data[1:], &raw); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if want := (RawStructure{Signature: 0x01, Fields: List{"a", List{"A"}}}); !reflect.DeepEqual(raw, want) {
+		t.Errorf("Unmarshal() = %#v, want %#v", raw, want)
+	}
+}
+
+func TestRegisterStructure_panics(t *testing.T) {
+	tests := []struct {
+		name    string
+		factory func() Structure
+	}{
+		{name: "nil factory", factory: nil},
+		{name: "not an Unmarshaler", factory: func() Structure { return Node{} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("RegisterStructure() expected panic")
+				}
+			}()
+
+			RegisterStructure(0x02, tt.factory)
+		})
+	}
+}
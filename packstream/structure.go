@@ -3,6 +3,10 @@ package packstream
 import (
 	"bytes"
 	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
 )
 
 // structMarkers is a quick lookup table for structs.
@@ -13,51 +17,250 @@ var structMarkers = [16]byte{
 	0xBC, 0xBD, 0xBE, 0xBF,
 }
 
-func writeStructHeader(buf *bytes.Buffer, s Structure) error {
-	if s.FieldCount() > (1 << 4) {
-		return errors.New("cannot encode structure with more than 16 fields")
+// writeStructHeader writes the marker and tag of a structure. The tag and field
+// count are taken separately from the Structure to avoid boxing the value.
+func writeStructHeader(e *encoder, tag byte, fieldCount uint) error {
+	if fieldCount >= uint(len(structMarkers)) {
+		return errors.New("cannot encode structure with more than 15 fields")
 	}
 
-	buf.WriteByte(0x80 + byte(s.FieldCount()))
-	buf.WriteByte(s.Tag())
+	e.w.WriteByte(structMarkers[fieldCount])
+	e.w.WriteByte(tag)
 
 	return nil
 }
 
+// unmarshalStructure decodes the structure in data into the field pointers of
+// s, in encoding order. The tag and number of fields must match s exactly.
+func unmarshalStructure(data []byte, s Structure, fields ...interface{}) error {
+	r := bytes.NewReader(data)
+	d := decoder{r: r}
+
+	marker, err := d.readMarker()
+	if err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	if marker < 0xB0 || marker > 0xBF {
+		return fmt.Errorf("cannot unmarshal marker 0x%02X into structure with tag 0x%02X", marker, s.Tag())
+	}
+
+	b, err := d.read(1)
+	if err != nil {
+		return err
+	}
+	if b[0] != s.Tag() {
+		return fmt.Errorf("cannot unmarshal structure with tag 0x%02X into structure with tag 0x%02X", b[0], s.Tag())
+	}
+
+	if size := uint(marker & 0x0F); size != s.FieldCount() || size != uint(len(fields)) {
+		return fmt.Errorf("structure with tag 0x%02X has %d fields, expected %d", s.Tag(), size, s.FieldCount())
+	}
+
+	for _, f := range fields {
+		val, err := d.decodeValue()
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		} else if err != nil {
+			return err
+		}
+
+		if err := assign(reflect.ValueOf(f).Elem(), val); err != nil {
+			return err
+		}
+	}
+
+	if r.Len() > 0 {
+		return fmt.Errorf("unexpected %d bytes of trailing data", r.Len())
+	}
+
+	return nil
+}
+
+// structFieldCount returns the number of fields given by the marker of the
+// structure in data, or 0 if data does not start with a structure marker.
+func structFieldCount(data []byte) uint {
+	if len(data) == 0 || data[0] < 0xB0 || data[0] > 0xBF {
+		return 0
+	}
+
+	return uint(data[0] & 0x0F)
+}
+
 type Structure interface {
 	Tag() byte
 	FieldCount() uint
 }
 
+// Tags of the UTC based DateTime and DateTimeZoneID structures. Their Seconds
+// field counts seconds since the Unix epoch in UTC rather than in the time
+// zone of the value.
+const (
+	dateTimeUTCTag       byte = 0x49
+	dateTimeZoneIDUTCTag byte = 0x69
+)
+
+// Number of fields of the graph structures in Bolt 5.0, which appends element
+// IDs to the fields of the legacy structures.
+const (
+	nodeElementIDFields       uint = 4
+	relElementIDFields        uint = 8
+	unboundRelElementIDFields uint = 4
+)
+
+// structHeader describes a structure for unmarshalStructure when the tag or
+// field count differs from the one reported by the Go type.
+type structHeader struct {
+	tag        byte
+	fieldCount uint
+}
+
+func (h structHeader) Tag() byte        { return h.tag }
+func (h structHeader) FieldCount() uint { return h.fieldCount }
+
+// RawStructure is a structure with arbitrary tag and fields. It is produced
+// when decoding structures with no registered Go type and can be used to
+// encode structures without declaring a dedicated type, such as Bolt
+// messages. The tag is held in Signature since Tag is needed to satisfy
+// Structure.
+type RawStructure struct {
+	Signature byte
+	Fields    List
+}
+
+func (s RawStructure) Tag() byte        { return s.Signature }
+func (s RawStructure) FieldCount() uint { return uint(len(s.Fields)) }
+
+func (s RawStructure) MarshalPackstream() ([]byte, error) {
+	return Marshal(s)
+}
+
+func (s RawStructure) encodePackstream(e *encoder) error {
+	if err := writeStructHeader(e, s.Signature, s.FieldCount()); err != nil {
+		return err
+	}
+
+	for _, f := range s.Fields {
+		if err := e.marshal(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalPackstream decodes a structure with any tag, bypassing the
+// registered types. The fields themselves are decoded as usual.
+func (s *RawStructure) UnmarshalPackstream(data []byte) error {
+	return Unmarshal(data, s)
+}
+
+// decodeRawStructure decodes the next value into s in a single pass, rather
+// than reading the encoding ahead of time as for other Unmarshalers.
+func (d *decoder) decodeRawStructure(s *RawStructure) error {
+	marker, err := d.readMarker()
+	if err != nil {
+		return err
+	}
+	if marker < 0xB0 || marker > 0xBF {
+		return fmt.Errorf("cannot unmarshal marker 0x%02X into RawStructure", marker)
+	}
+
+	b, err := d.read(1)
+	if err != nil {
+		return err
+	}
+	s.Signature = b[0]
+
+	if s.Fields, err = d.decodeList(int(marker & 0x0F)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	return nil
+}
+
+// scanStructure implements sql.Scanner for the structure pointed to by dst,
+// which accepts values of its own type as returned by a database/sql driver.
+func scanStructure(dst Structure, src interface{}) error {
+	v := reflect.ValueOf(dst).Elem()
+	if src == nil {
+		return fmt.Errorf("cannot scan NULL into %s", v.Type())
+	}
+
+	s := reflect.ValueOf(src)
+	switch {
+	case s.Type() == v.Type():
+		v.Set(s)
+	case s.Type() == reflect.PtrTo(v.Type()) && !s.IsNil():
+		v.Set(s.Elem())
+	default:
+		return fmt.Errorf("cannot scan %T into %s", src, v.Type())
+	}
+
+	return nil
+}
+
 type Node struct {
 	ID         int
 	Labels     List
 	Properties Dictionary
+	// ElementID is only sent from Bolt 5.0 onwards.
+	ElementID string
 }
 
 func (Node) Tag() byte        { return 0x4E }
 func (Node) FieldCount() uint { return 3 }
 
 func (n Node) MarshalPackstream() ([]byte, error) {
-	buf := new(bytes.Buffer)
+	return Marshal(n)
+}
+
+func (n Node) encodePackstream(e *encoder) error {
+	fieldCount := n.FieldCount()
+	if e.elementIDs {
+		fieldCount = nodeElementIDFields
+	}
 
-	if err := writeStructHeader(buf, n); err != nil {
-		return nil, err
+	if err := writeStructHeader(e, n.Tag(), fieldCount); err != nil {
+		return err
 	}
 
-	if err := encodeInt(buf, n.ID); err != nil {
-		return nil, err
+	if err := e.encodeInt(n.ID); err != nil {
+		return err
 	}
 
-	if err := encodeMarshaller(buf, n.Labels); err != nil {
-		return nil, err
+	if err := n.Labels.encodePackstream(e); err != nil {
+		return err
 	}
 
-	if err := encodeMarshaller(buf, n.Properties); err != nil {
-		return nil, err
+	if err := n.Properties.encodePackstream(e); err != nil {
+		return err
 	}
 
-	return buf.Bytes(), nil
+	if e.elementIDs {
+		if err := e.encodeString(n.ElementID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalPackstream decodes both the legacy structure and the one with an
+// element ID introduced in Bolt 5.0.
+func (n *Node) UnmarshalPackstream(data []byte) error {
+	if structFieldCount(data) != nodeElementIDFields {
+		return unmarshalStructure(data, n, &n.ID, &n.Labels, &n.Properties)
+	}
+
+	h := structHeader{tag: n.Tag(), fieldCount: nodeElementIDFields}
+	return unmarshalStructure(data, h, &n.ID, &n.Labels, &n.Properties, &n.ElementID)
+}
+
+func (n *Node) Scan(src interface{}) error {
+	return scanStructure(n, src)
 }
 
 type Relationship struct {
@@ -66,70 +269,135 @@ type Relationship struct {
 	EndNodeID   int
 	Type        string
 	Properties  Dictionary
+	// The element IDs are only sent from Bolt 5.0 onwards.
+	ElementID          string
+	StartNodeElementID string
+	EndNodeElementID   string
 }
 
 func (Relationship) Tag() byte        { return 0x52 }
 func (Relationship) FieldCount() uint { return 5 }
 
 func (r Relationship) MarshalPackstream() ([]byte, error) {
-	buf := new(bytes.Buffer)
+	return Marshal(r)
+}
 
-	if err := writeStructHeader(buf, r); err != nil {
-		return nil, err
+func (r Relationship) encodePackstream(e *encoder) error {
+	fieldCount := r.FieldCount()
+	if e.elementIDs {
+		fieldCount = relElementIDFields
 	}
 
-	if err := encodeInt(buf, r.ID); err != nil {
-		return nil, err
+	if err := writeStructHeader(e, r.Tag(), fieldCount); err != nil {
+		return err
 	}
 
-	if err := encodeInt(buf, r.StartNodeID); err != nil {
-		return nil, err
+	if err := e.encodeInt(r.ID); err != nil {
+		return err
 	}
 
-	if err := encodeInt(buf, r.EndNodeID); err != nil {
-		return nil, err
+	if err := e.encodeInt(r.StartNodeID); err != nil {
+		return err
 	}
 
-	if err := encodeString(buf, r.Type); err != nil {
-		return nil, err
+	if err := e.encodeInt(r.EndNodeID); err != nil {
+		return err
 	}
 
-	if err := encodeMarshaller(buf, r.Properties); err != nil {
-		return nil, err
+	if err := e.encodeString(r.Type); err != nil {
+		return err
 	}
 
-	return buf.Bytes(), nil
+	if err := r.Properties.encodePackstream(e); err != nil {
+		return err
+	}
+
+	if e.elementIDs {
+		for _, id := range [...]string{r.ElementID, r.StartNodeElementID, r.EndNodeElementID} {
+			if err := e.encodeString(id); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalPackstream decodes both the legacy structure and the one with
+// element IDs introduced in Bolt 5.0.
+func (r *Relationship) UnmarshalPackstream(data []byte) error {
+	if structFieldCount(data) != relElementIDFields {
+		return unmarshalStructure(data, r, &r.ID, &r.StartNodeID, &r.EndNodeID, &r.Type, &r.Properties)
+	}
+
+	h := structHeader{tag: r.Tag(), fieldCount: relElementIDFields}
+	return unmarshalStructure(data, h, &r.ID, &r.StartNodeID, &r.EndNodeID, &r.Type, &r.Properties,
+		&r.ElementID, &r.StartNodeElementID, &r.EndNodeElementID)
+}
+
+func (r *Relationship) Scan(src interface{}) error {
+	return scanStructure(r, src)
 }
 
 type UnboundRelationship struct {
 	ID         int
 	Type       string
 	Properties Dictionary
+	// ElementID is only sent from Bolt 5.0 onwards.
+	ElementID string
 }
 
 func (UnboundRelationship) Tag() byte        { return 0x72 }
 func (UnboundRelationship) FieldCount() uint { return 3 }
 
 func (r UnboundRelationship) MarshalPackstream() ([]byte, error) {
-	buf := new(bytes.Buffer)
+	return Marshal(r)
+}
+
+func (r UnboundRelationship) encodePackstream(e *encoder) error {
+	fieldCount := r.FieldCount()
+	if e.elementIDs {
+		fieldCount = unboundRelElementIDFields
+	}
+
+	if err := writeStructHeader(e, r.Tag(), fieldCount); err != nil {
+		return err
+	}
 
-	if err := writeStructHeader(buf, r); err != nil {
-		return nil, err
+	if err := e.encodeInt(r.ID); err != nil {
+		return err
 	}
 
-	if err := encodeInt(buf, r.ID); err != nil {
-		return nil, err
+	if err := e.encodeString(r.Type); err != nil {
+		return err
 	}
 
-	if err := encodeString(buf, r.Type); err != nil {
-		return nil, err
+	if err := r.Properties.encodePackstream(e); err != nil {
+		return err
 	}
 
-	if err := encodeMarshaller(buf, r.Properties); err != nil {
-		return nil, err
+	if e.elementIDs {
+		if err := e.encodeString(r.ElementID); err != nil {
+			return err
+		}
 	}
 
-	return buf.Bytes(), nil
+	return nil
+}
+
+// UnmarshalPackstream decodes both the legacy structure and the one with an
+// element ID introduced in Bolt 5.0.
+func (r *UnboundRelationship) UnmarshalPackstream(data []byte) error {
+	if structFieldCount(data) != unboundRelElementIDFields {
+		return unmarshalStructure(data, r, &r.ID, &r.Type, &r.Properties)
+	}
+
+	h := structHeader{tag: r.Tag(), fieldCount: unboundRelElementIDFields}
+	return unmarshalStructure(data, h, &r.ID, &r.Type, &r.Properties, &r.ElementID)
+}
+
+func (r *UnboundRelationship) Scan(src interface{}) error {
+	return scanStructure(r, src)
 }
 
 type Path struct {
@@ -145,25 +413,35 @@ func (Path) Tag() byte        { return 0x50 }
 func (Path) FieldCount() uint { return 3 }
 
 func (p Path) MarshalPackstream() ([]byte, error) {
-	buf := new(bytes.Buffer)
+	return Marshal(p)
+}
 
-	if err := writeStructHeader(buf, p); err != nil {
-		return nil, err
+func (p Path) encodePackstream(e *encoder) error {
+	if err := writeStructHeader(e, p.Tag(), p.FieldCount()); err != nil {
+		return err
 	}
 
-	if err := encodeMarshaller(buf, p.Nodes); err != nil {
-		return nil, err
+	if err := p.Nodes.encodePackstream(e); err != nil {
+		return err
 	}
 
-	if err := encodeMarshaller(buf, p.Rels); err != nil {
-		return nil, err
+	if err := p.Rels.encodePackstream(e); err != nil {
+		return err
 	}
 
-	if err := encodeMarshaller(buf, p.IDs); err != nil {
-		return nil, err
+	if err := p.IDs.encodePackstream(e); err != nil {
+		return err
 	}
 
-	return buf.Bytes(), nil
+	return nil
+}
+
+func (p *Path) UnmarshalPackstream(data []byte) error {
+	return unmarshalStructure(data, p, &p.Nodes, &p.Rels, &p.IDs)
+}
+
+func (p *Path) Scan(src interface{}) error {
+	return scanStructure(p, src)
 }
 
 type Date struct {
@@ -174,17 +452,27 @@ func (Date) Tag() byte        { return 0x44 }
 func (Date) FieldCount() uint { return 1 }
 
 func (d Date) MarshalPackstream() ([]byte, error) {
-	buf := new(bytes.Buffer)
+	return Marshal(d)
+}
 
-	if err := writeStructHeader(buf, d); err != nil {
-		return nil, err
+func (d Date) encodePackstream(e *encoder) error {
+	if err := writeStructHeader(e, d.Tag(), d.FieldCount()); err != nil {
+		return err
 	}
 
-	if err := encodeInt(buf, d.Days); err != nil {
-		return nil, err
+	if err := e.encodeInt(d.Days); err != nil {
+		return err
 	}
 
-	return buf.Bytes(), nil
+	return nil
+}
+
+func (d *Date) UnmarshalPackstream(data []byte) error {
+	return unmarshalStructure(data, d, &d.Days)
+}
+
+func (d *Date) Scan(src interface{}) error {
+	return scanStructure(d, src)
 }
 
 type Time struct {
@@ -196,21 +484,31 @@ func (Time) Tag() byte        { return 0x54 }
 func (Time) FieldCount() uint { return 2 }
 
 func (t Time) MarshalPackstream() ([]byte, error) {
-	buf := new(bytes.Buffer)
+	return Marshal(t)
+}
 
-	if err := writeStructHeader(buf, t); err != nil {
-		return nil, err
+func (t Time) encodePackstream(e *encoder) error {
+	if err := writeStructHeader(e, t.Tag(), t.FieldCount()); err != nil {
+		return err
 	}
 
-	if err := encodeInt(buf, t.Nanoseconds); err != nil {
-		return nil, err
+	if err := e.encodeInt(t.Nanoseconds); err != nil {
+		return err
 	}
 
-	if err := encodeInt(buf, t.TZOffsetSeconds); err != nil {
-		return nil, err
+	if err := e.encodeInt(t.TZOffsetSeconds); err != nil {
+		return err
 	}
 
-	return buf.Bytes(), nil
+	return nil
+}
+
+func (t *Time) UnmarshalPackstream(data []byte) error {
+	return unmarshalStructure(data, t, &t.Nanoseconds, &t.TZOffsetSeconds)
+}
+
+func (t *Time) Scan(src interface{}) error {
+	return scanStructure(t, src)
 }
 
 func (t Time) ToUTCNanoseconds() int {
@@ -225,17 +523,27 @@ func (LocalTime) Tag() byte        { return 0x74 }
 func (LocalTime) FieldCount() uint { return 1 }
 
 func (t LocalTime) MarshalPackstream() ([]byte, error) {
-	buf := new(bytes.Buffer)
+	return Marshal(t)
+}
 
-	if err := writeStructHeader(buf, t); err != nil {
-		return nil, err
+func (t LocalTime) encodePackstream(e *encoder) error {
+	if err := writeStructHeader(e, t.Tag(), t.FieldCount()); err != nil {
+		return err
 	}
 
-	if err := encodeInt(buf, t.Nanoseconds); err != nil {
-		return nil, err
+	if err := e.encodeInt(t.Nanoseconds); err != nil {
+		return err
 	}
 
-	return buf.Bytes(), nil
+	return nil
+}
+
+func (t *LocalTime) UnmarshalPackstream(data []byte) error {
+	return unmarshalStructure(data, t, &t.Nanoseconds)
+}
+
+func (t *LocalTime) Scan(src interface{}) error {
+	return scanStructure(t, src)
 }
 
 type DateTime struct {
@@ -244,29 +552,66 @@ type DateTime struct {
 	TZOffsetSeconds int
 }
 
+// DateTimeOf returns the DateTime of t in its own time zone offset.
+func DateTimeOf(t time.Time) DateTime {
+	_, offset := t.Zone()
+	return DateTime{
+		Seconds:         int(t.Unix()) + offset,
+		Nanoseconds:     t.Nanosecond(),
+		TZOffsetSeconds: offset,
+	}
+}
+
 func (DateTime) Tag() byte        { return 0x46 }
 func (DateTime) FieldCount() uint { return 3 }
 
 func (t DateTime) MarshalPackstream() ([]byte, error) {
-	buf := new(bytes.Buffer)
+	return Marshal(t)
+}
+
+func (t DateTime) encodePackstream(e *encoder) error {
+	tag, seconds := t.Tag(), t.Seconds
+	if e.utcDateTime {
+		tag, seconds = dateTimeUTCTag, t.Seconds-t.TZOffsetSeconds
+	}
 
-	if err := writeStructHeader(buf, t); err != nil {
-		return nil, err
+	if err := writeStructHeader(e, tag, t.FieldCount()); err != nil {
+		return err
 	}
 
-	if err := encodeInt(buf, t.Seconds); err != nil {
-		return nil, err
+	if err := e.encodeInt(seconds); err != nil {
+		return err
 	}
 
-	if err := encodeInt(buf, t.Nanoseconds); err != nil {
-		return nil, err
+	if err := e.encodeInt(t.Nanoseconds); err != nil {
+		return err
 	}
 
-	if err := encodeInt(buf, t.TZOffsetSeconds); err != nil {
-		return nil, err
+	if err := e.encodeInt(t.TZOffsetSeconds); err != nil {
+		return err
 	}
 
-	return buf.Bytes(), nil
+	return nil
+}
+
+// UnmarshalPackstream decodes both the legacy structure and its UTC based
+// variant introduced in Bolt 5.0.
+func (t *DateTime) UnmarshalPackstream(data []byte) error {
+	if len(data) < 2 || data[1] != dateTimeUTCTag {
+		return unmarshalStructure(data, t, &t.Seconds, &t.Nanoseconds, &t.TZOffsetSeconds)
+	}
+
+	h := structHeader{tag: dateTimeUTCTag, fieldCount: t.FieldCount()}
+	if err := unmarshalStructure(data, h, &t.Seconds, &t.Nanoseconds, &t.TZOffsetSeconds); err != nil {
+		return err
+	}
+	t.Seconds += t.TZOffsetSeconds
+
+	return nil
+}
+
+func (t *DateTime) Scan(src interface{}) error {
+	return scanStructure(t, src)
 }
 
 func (t DateTime) ToUTCNanoseconds() int {
@@ -283,25 +628,67 @@ func (DateTimeZoneID) Tag() byte        { return 0x66 }
 func (DateTimeZoneID) FieldCount() uint { return 3 }
 
 func (t DateTimeZoneID) MarshalPackstream() ([]byte, error) {
-	buf := new(bytes.Buffer)
+	return Marshal(t)
+}
+
+func (t DateTimeZoneID) encodePackstream(e *encoder) error {
+	tag, seconds := t.Tag(), t.Seconds
+	if e.utcDateTime {
+		loc, err := time.LoadLocation(t.TimeZoneID)
+		if err != nil {
+			return err
+		}
+
+		// Seconds counts the wall clock time in the zone, which has to be
+		// resolved to an instant.
+		w := time.Unix(int64(t.Seconds), 0).UTC()
+		utc := time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), w.Second(), 0, loc)
+		tag, seconds = dateTimeZoneIDUTCTag, int(utc.Unix())
+	}
+
+	if err := writeStructHeader(e, tag, t.FieldCount()); err != nil {
+		return err
+	}
+
+	if err := e.encodeInt(seconds); err != nil {
+		return err
+	}
 
-	if err := writeStructHeader(buf, t); err != nil {
-		return nil, err
+	if err := e.encodeInt(t.Nanoseconds); err != nil {
+		return err
 	}
 
-	if err := encodeInt(buf, t.Seconds); err != nil {
-		return nil, err
+	if err := e.encodeString(t.TimeZoneID); err != nil {
+		return err
 	}
 
-	if err := encodeInt(buf, t.Nanoseconds); err != nil {
-		return nil, err
+	return nil
+}
+
+// UnmarshalPackstream decodes both the legacy structure and its UTC based
+// variant introduced in Bolt 5.0.
+func (t *DateTimeZoneID) UnmarshalPackstream(data []byte) error {
+	if len(data) < 2 || data[1] != dateTimeZoneIDUTCTag {
+		return unmarshalStructure(data, t, &t.Seconds, &t.Nanoseconds, &t.TimeZoneID)
 	}
 
-	if err := encodeString(buf, t.TimeZoneID); err != nil {
-		return nil, err
+	h := structHeader{tag: dateTimeZoneIDUTCTag, fieldCount: t.FieldCount()}
+	if err := unmarshalStructure(data, h, &t.Seconds, &t.Nanoseconds, &t.TimeZoneID); err != nil {
+		return err
 	}
 
-	return buf.Bytes(), nil
+	loc, err := time.LoadLocation(t.TimeZoneID)
+	if err != nil {
+		return err
+	}
+	_, offset := time.Unix(int64(t.Seconds), 0).In(loc).Zone()
+	t.Seconds += offset
+
+	return nil
+}
+
+func (t *DateTimeZoneID) Scan(src interface{}) error {
+	return scanStructure(t, src)
 }
 
 type LocalDateTime struct {
@@ -313,21 +700,31 @@ func (LocalDateTime) Tag() byte        { return 0x64 }
 func (LocalDateTime) FieldCount() uint { return 2 }
 
 func (t LocalDateTime) MarshalPackstream() ([]byte, error) {
-	buf := new(bytes.Buffer)
+	return Marshal(t)
+}
 
-	if err := writeStructHeader(buf, t); err != nil {
-		return nil, err
+func (t LocalDateTime) encodePackstream(e *encoder) error {
+	if err := writeStructHeader(e, t.Tag(), t.FieldCount()); err != nil {
+		return err
 	}
 
-	if err := encodeInt(buf, t.Seconds); err != nil {
-		return nil, err
+	if err := e.encodeInt(t.Seconds); err != nil {
+		return err
 	}
 
-	if err := encodeInt(buf, t.Nanoseconds); err != nil {
-		return nil, err
+	if err := e.encodeInt(t.Nanoseconds); err != nil {
+		return err
 	}
 
-	return buf.Bytes(), nil
+	return nil
+}
+
+func (t *LocalDateTime) UnmarshalPackstream(data []byte) error {
+	return unmarshalStructure(data, t, &t.Seconds, &t.Nanoseconds)
+}
+
+func (t *LocalDateTime) Scan(src interface{}) error {
+	return scanStructure(t, src)
 }
 
 type Duration struct {
@@ -341,29 +738,39 @@ func (Duration) Tag() byte        { return 0x45 }
 func (Duration) FieldCount() uint { return 4 }
 
 func (d Duration) MarshalPackstream() ([]byte, error) {
-	buf := new(bytes.Buffer)
+	return Marshal(d)
+}
 
-	if err := writeStructHeader(buf, d); err != nil {
-		return nil, err
+func (d Duration) encodePackstream(e *encoder) error {
+	if err := writeStructHeader(e, d.Tag(), d.FieldCount()); err != nil {
+		return err
 	}
 
-	if err := encodeInt(buf, d.Months); err != nil {
-		return nil, err
+	if err := e.encodeInt(d.Months); err != nil {
+		return err
 	}
 
-	if err := encodeInt(buf, d.Days); err != nil {
-		return nil, err
+	if err := e.encodeInt(d.Days); err != nil {
+		return err
 	}
 
-	if err := encodeInt(buf, d.Seconds); err != nil {
-		return nil, err
+	if err := e.encodeInt(d.Seconds); err != nil {
+		return err
 	}
 
-	if err := encodeInt(buf, d.Nanoseconds); err != nil {
-		return nil, err
+	if err := e.encodeInt(d.Nanoseconds); err != nil {
+		return err
 	}
 
-	return buf.Bytes(), nil
+	return nil
+}
+
+func (d *Duration) UnmarshalPackstream(data []byte) error {
+	return unmarshalStructure(data, d, &d.Months, &d.Days, &d.Seconds, &d.Nanoseconds)
+}
+
+func (d *Duration) Scan(src interface{}) error {
+	return scanStructure(d, src)
 }
 
 type Point2D struct {
@@ -376,25 +783,35 @@ func (Point2D) Tag() byte        { return 0x58 }
 func (Point2D) FieldCount() uint { return 3 }
 
 func (p Point2D) MarshalPackstream() ([]byte, error) {
-	buf := new(bytes.Buffer)
+	return Marshal(p)
+}
 
-	if err := writeStructHeader(buf, p); err != nil {
-		return nil, err
+func (p Point2D) encodePackstream(e *encoder) error {
+	if err := writeStructHeader(e, p.Tag(), p.FieldCount()); err != nil {
+		return err
 	}
 
-	if err := encodeInt(buf, p.SRID); err != nil {
-		return nil, err
+	if err := e.encodeInt(p.SRID); err != nil {
+		return err
 	}
 
-	if err := encodeFloat(buf, p.X); err != nil {
-		return nil, err
+	if err := e.encodeFloat(p.X); err != nil {
+		return err
 	}
 
-	if err := encodeFloat(buf, p.Y); err != nil {
-		return nil, err
+	if err := e.encodeFloat(p.Y); err != nil {
+		return err
 	}
 
-	return buf.Bytes(), nil
+	return nil
+}
+
+func (p *Point2D) UnmarshalPackstream(data []byte) error {
+	return unmarshalStructure(data, p, &p.SRID, &p.X, &p.Y)
+}
+
+func (p *Point2D) Scan(src interface{}) error {
+	return scanStructure(p, src)
 }
 
 type Point3D struct {
@@ -408,27 +825,37 @@ func (Point3D) Tag() byte        { return 0x59 }
 func (Point3D) FieldCount() uint { return 4 }
 
 func (p Point3D) MarshalPackstream() ([]byte, error) {
-	buf := new(bytes.Buffer)
+	return Marshal(p)
+}
 
-	if err := writeStructHeader(buf, p); err != nil {
-		return nil, err
+func (p Point3D) encodePackstream(e *encoder) error {
+	if err := writeStructHeader(e, p.Tag(), p.FieldCount()); err != nil {
+		return err
 	}
 
-	if err := encodeInt(buf, p.SRID); err != nil {
-		return nil, err
+	if err := e.encodeInt(p.SRID); err != nil {
+		return err
 	}
 
-	if err := encodeFloat(buf, p.X); err != nil {
-		return nil, err
+	if err := e.encodeFloat(p.X); err != nil {
+		return err
 	}
 
-	if err := encodeFloat(buf, p.Y); err != nil {
-		return nil, err
+	if err := e.encodeFloat(p.Y); err != nil {
+		return err
 	}
 
-	if err := encodeFloat(buf, p.Z); err != nil {
-		return nil, err
+	if err := e.encodeFloat(p.Z); err != nil {
+		return err
 	}
 
-	return buf.Bytes(), nil
+	return nil
+}
+
+func (p *Point3D) UnmarshalPackstream(data []byte) error {
+	return unmarshalStructure(data, p, &p.SRID, &p.X, &p.Y, &p.Z)
+}
+
+func (p *Point3D) Scan(src interface{}) error {
+	return scanStructure(p, src)
 }
@@ -0,0 +1,146 @@
+package packstream
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStructure_UnmarshalPackstream(t *testing.T) {
+	tests := []struct {
+		name string
+		s    Structure
+	}{
+		{
+			name: "node",
+			s:    &Node{ID: 1, Labels: List{"A"}, Properties: Dictionary{"a": int64(1)}},
+		},
+		{
+			name: "relationship",
+			s:    &Relationship{ID: 1, StartNodeID: 2, EndNodeID: 3, Type: "R", Properties: Dictionary{}},
+		},
+		{
+			name: "unbound relationship",
+			s:    &UnboundRelationship{ID: 1, Type: "R", Properties: Dictionary{}},
+		},
+		{
+			name: "path",
+			s: &Path{
+				Nodes: List{Node{ID: 1, Labels: List{}, Properties: Dictionary{}}},
+				Rels:  List{UnboundRelationship{ID: 2, Type: "R", Properties: Dictionary{}}},
+				IDs:   List{int64(1), int64(1)},
+			},
+		},
+		{
+			name: "date",
+			s:    &Date{Days: 18_000},
+		},
+		{
+			name: "time",
+			s:    &Time{Nanoseconds: 1_000, TZOffsetSeconds: -3_600},
+		},
+		{
+			name: "local time",
+			s:    &LocalTime{Nanoseconds: 1_000},
+		},
+		{
+			name: "date time",
+			s:    &DateTime{Seconds: 1_600_000_000, Nanoseconds: 5, TZOffsetSeconds: 7_200},
+		},
+		{
+			name: "date time zone id",
+			s:    &DateTimeZoneID{Seconds: 1_600_000_000, Nanoseconds: 5, TimeZoneID: "Europe/Stockholm"},
+		},
+		{
+			name: "local date time",
+			s:    &LocalDateTime{Seconds: 1_600_000_000, Nanoseconds: 5},
+		},
+		{
+			name: "duration",
+			s:    &Duration{Months: 1, Days: 2, Seconds: 3, Nanoseconds: 4},
+		},
+		{
+			name: "point 2d",
+			s:    &Point2D{SRID: 7203, X: 1.5, Y: -2},
+		},
+		{
+			name: "point 3d",
+			s:    &Point3D{SRID: 9157, X: 1.5, Y: -2, Z: 3.25},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := reflect.ValueOf(tt.s).Elem().Interface()
+
+			data, err := Marshal(want)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+
+			got := reflect.New(reflect.TypeOf(want))
+			if err := got.Interface().(Unmarshaler).UnmarshalPackstream(data); err != nil {
+				t.Fatalf("UnmarshalPackstream() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Elem().Interface(), want) {
+				t.Errorf("UnmarshalPackstream() = %#v, want %#v", got.Elem().Interface(), want)
+			}
+
+			// Dropping the last field must be rejected.
+			short := append([]byte{data[0] - 1}, data[1:]...)
+			if err := got.Interface().(Unmarshaler).UnmarshalPackstream(short); err == nil {
+				t.Error("UnmarshalPackstream() expected error for wrong field count")
+			}
+		})
+	}
+}
+
+func TestStructure_UnmarshalPackstream_errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: []byte{}},
+		{name: "not a structure", data: []byte{0x91, 0x01}},
+		{name: "wrong tag", data: []byte{0xB1, 0x45, 0x01}},
+		{name: "truncated field", data: []byte{0xB1, 0x44, 0xC9, 0x00}},
+		{name: "wrong field type", data: []byte{0xB1, 0x44, 0x81, 0x61}},
+		{name: "trailing data", data: []byte{0xB1, 0x44, 0x01, 0x01}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d Date
+			if err := d.UnmarshalPackstream(tt.data); err == nil {
+				t.Errorf("Date.UnmarshalPackstream() expected error, got %#v", d)
+			}
+		})
+	}
+}
+
+func TestStructure_Scan(t *testing.T) {
+	node := Node{ID: 1, Labels: List{"A"}, Properties: Dictionary{"a": int64(1)}}
+
+	tests := []struct {
+		name    string
+		src     interface{}
+		want    Node
+		wantErr bool
+	}{
+		{name: "value", src: node, want: node},
+		{name: "pointer", src: &node, want: node},
+		{name: "nil pointer", src: (*Node)(nil), wantErr: true},
+		{name: "NULL", src: nil, wantErr: true},
+		{name: "other structure", src: Date{Days: 1}, wantErr: true},
+		{name: "other type", src: "node", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Node
+			err := got.Scan(tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Node.Scan() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Node.Scan() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
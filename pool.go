@@ -0,0 +1,337 @@
+package graphdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mattmeyers/graphdb/bolt"
+)
+
+// ErrDriverClosed is returned when acquiring a connection from a closed
+// driver.
+var ErrDriverClosed = errors.New("graphdb: driver closed")
+
+// PoolMetrics describes the connections to a single server.
+type PoolMetrics struct {
+	// InUse is the number of connections held by sessions, including
+	// connections being opened.
+	InUse int
+
+	// Idle is the number of connections waiting in the pool.
+	Idle int
+
+	// Waiters is the number of sessions waiting for a connection because the
+	// pool is full.
+	Waiters int
+
+	// Created and Closed count the connections opened and closed over the
+	// lifetime of the pool.
+	Created int64
+	Closed  int64
+}
+
+// pooledConn is a connection owned by a pool.
+type pooledConn struct {
+	*bolt.Conn
+
+	// auth is the token the connection is authenticated with.
+	auth AuthToken
+
+	addr     string
+	created  time.Time
+	lastUsed time.Time
+}
+
+// pool holds idle connections per server address and limits the number of
+// connections to each server.
+type pool struct {
+	connect func(ctx context.Context, addr string) (*bolt.Conn, AuthToken, error)
+
+	// reauth, if set, prepares an idle connection for reuse, e.g. by
+	// updating its credentials. Connections it fails for are closed, and
+	// security errors are returned by acquire.
+	reauth func(ctx context.Context, c *pooledConn) error
+
+	maxSize            int
+	acquisitionTimeout time.Duration
+	maxLifetime        time.Duration
+	livenessCheck      time.Duration
+
+	// now returns the current time. It is replaced in tests.
+	now func() time.Time
+
+	mu      sync.Mutex
+	servers map[string]*serverPool
+	closed  bool
+}
+
+// serverPool holds the connections to a single server.
+type serverPool struct {
+	idle    []*pooledConn
+	inUse   int
+	waiters int
+	created int64
+	closed  int64
+
+	// released is closed and replaced whenever a connection is released,
+	// waking up the sessions waiting for one.
+	released chan struct{}
+}
+
+func newPool(config Config, connect func(ctx context.Context, addr string) (*bolt.Conn, AuthToken, error)) *pool {
+	return &pool{
+		connect:            connect,
+		maxSize:            config.MaxConnectionPoolSize,
+		acquisitionTimeout: config.ConnectionAcquisitionTimeout,
+		maxLifetime:        config.MaxConnectionLifetime,
+		livenessCheck:      config.IdleLivenessCheck,
+		now:                time.Now,
+		servers:            make(map[string]*serverPool),
+	}
+}
+
+// server returns the pool of addr. p.mu must be held.
+func (p *pool) server(addr string) *serverPool {
+	sp, ok := p.servers[addr]
+	if !ok {
+		sp = &serverPool{released: make(chan struct{})}
+		p.servers[addr] = sp
+	}
+
+	return sp
+}
+
+// acquire returns a connection to addr, reusing an idle connection if there
+// is one. If the pool for addr is full, acquire waits for a connection to be
+// released until ctx is done or the acquisition timeout passes.
+func (p *pool) acquire(ctx context.Context, addr string) (*pooledConn, error) {
+	if p.acquisitionTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.acquisitionTimeout)
+		defer cancel()
+	}
+
+	for {
+		c, wait, err := p.tryAcquire(ctx, addr)
+		if c != nil || err != nil {
+			return c, err
+		}
+		if wait == nil {
+			// An idle connection failed its liveness check.
+			continue
+		}
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+
+		p.mu.Lock()
+		p.server(addr).waiters--
+		p.mu.Unlock()
+
+		if err != nil {
+			return nil, fmt.Errorf("graphdb: no connection to %s available: %w", addr, err)
+		}
+	}
+}
+
+// tryAcquire returns an idle or new connection to addr. If the pool is full,
+// it registers a waiter and returns a channel closed once a connection has
+// been released.
+func (p *pool) tryAcquire(ctx context.Context, addr string) (*pooledConn, <-chan struct{}, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, nil, ErrDriverClosed
+	}
+
+	sp := p.server(addr)
+	c, stale := p.popIdle(sp)
+	full := p.maxSize > 0 && sp.inUse+len(sp.idle) >= p.maxSize
+	switch {
+	case c != nil, !full:
+		sp.inUse++
+	default:
+		sp.waiters++
+	}
+	released := sp.released
+	p.mu.Unlock()
+
+	for _, c := range stale {
+		c.Close()
+	}
+
+	switch {
+	case c != nil:
+		if !p.alive(ctx, c) {
+			p.discard(c)
+			return nil, nil, nil
+		}
+		if p.reauth != nil {
+			if err := p.reauth(ctx, c); err != nil {
+				p.discard(c)
+				// The credentials would be rejected on any connection.
+				if isSecurityError(err) {
+					return nil, nil, err
+				}
+				return nil, nil, nil
+			}
+		}
+		return c, nil, nil
+	case !full:
+		c, err := p.open(ctx, addr)
+		return c, nil, err
+	}
+
+	return nil, released, nil
+}
+
+// popIdle removes and returns the most recently used idle connection of sp
+// that has not exceeded its lifetime. Expired connections passed over are
+// removed as well and returned for the caller to close. p.mu must be held.
+func (p *pool) popIdle(sp *serverPool) (c *pooledConn, stale []*pooledConn) {
+	for len(sp.idle) > 0 {
+		c := sp.idle[len(sp.idle)-1]
+		sp.idle = sp.idle[:len(sp.idle)-1]
+
+		if reusable(c) && !p.expired(c) {
+			return c, stale
+		}
+
+		sp.closed++
+		stale = append(stale, c)
+	}
+
+	return nil, stale
+}
+
+// open opens a new connection to addr. The caller must have counted it as
+// in use.
+func (p *pool) open(ctx context.Context, addr string) (*pooledConn, error) {
+	conn, auth, err := p.connect(ctx, addr)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sp := p.server(addr)
+	if err != nil {
+		sp.inUse--
+		p.notify(sp)
+		return nil, err
+	}
+	sp.created++
+
+	now := p.now()
+	return &pooledConn{Conn: conn, auth: auth, addr: addr, created: now, lastUsed: now}, nil
+}
+
+// alive reports whether an idle connection can be reused, checking it with
+// a RESET round trip if it has been idle for too long. Interrupted
+// connections are reset to read the responses to their RESET.
+func (p *pool) alive(ctx context.Context, c *pooledConn) bool {
+	if c.State() == bolt.Ready && (p.livenessCheck <= 0 || p.now().Sub(c.lastUsed) < p.livenessCheck) {
+		return true
+	}
+
+	return c.Reset(ctx) == nil
+}
+
+// expired reports whether c has exceeded the maximum connection lifetime.
+func (p *pool) expired(c *pooledConn) bool {
+	return p.maxLifetime > 0 && p.now().Sub(c.created) >= p.maxLifetime
+}
+
+// release returns a connection to the pool. Connections that cannot be
+// reused, e.g. because they are DEFUNCT, are closed instead.
+func (p *pool) release(c *pooledConn) {
+	p.mu.Lock()
+	sp := p.server(c.addr)
+	sp.inUse--
+
+	reuse := !p.closed && reusable(c) && !p.expired(c)
+	if reuse {
+		c.lastUsed = p.now()
+		sp.idle = append(sp.idle, c)
+	} else {
+		sp.closed++
+	}
+	p.notify(sp)
+	p.mu.Unlock()
+
+	if !reuse {
+		c.Close()
+	}
+}
+
+// reusable reports whether c can be handed out again. Connections
+// interrupted by a cancelled operation are kept, so that the caller does not
+// have to wait for the server to abandon its work. They are reset when
+// acquired next.
+func reusable(c *pooledConn) bool {
+	return c.State() == bolt.Ready || c.State() == bolt.Interrupted
+}
+
+// discard closes an acquired connection instead of releasing it.
+func (p *pool) discard(c *pooledConn) {
+	p.mu.Lock()
+	sp := p.server(c.addr)
+	sp.inUse--
+	sp.closed++
+	p.notify(sp)
+	p.mu.Unlock()
+
+	c.Close()
+}
+
+// notify wakes up the sessions waiting for a connection of sp. p.mu must be
+// held.
+func (p *pool) notify(sp *serverPool) {
+	close(sp.released)
+	sp.released = make(chan struct{})
+}
+
+// metrics returns the metrics of the pool of each known server.
+func (p *pool) metrics() map[string]PoolMetrics {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	m := make(map[string]PoolMetrics, len(p.servers))
+	for addr, sp := range p.servers {
+		m[addr] = PoolMetrics{
+			InUse:   sp.inUse,
+			Idle:    len(sp.idle),
+			Waiters: sp.waiters,
+			Created: sp.created,
+			Closed:  sp.closed,
+		}
+	}
+
+	return m
+}
+
+// close closes the idle connections and makes the pool close connections as
+// they are released.
+func (p *pool) close() error {
+	p.mu.Lock()
+	p.closed = true
+
+	var idle []*pooledConn
+	for _, sp := range p.servers {
+		idle = append(idle, sp.idle...)
+		sp.closed += int64(len(sp.idle))
+		sp.idle = nil
+		p.notify(sp)
+	}
+	p.mu.Unlock()
+
+	for _, c := range idle {
+		c.Close()
+	}
+
+	return nil
+}
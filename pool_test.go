@@ -0,0 +1,336 @@
+package graphdb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattmeyers/graphdb/bolt"
+	"github.com/mattmeyers/graphdb/bolt/bolttest"
+	"github.com/mattmeyers/graphdb/packstream"
+)
+
+// testClock is a manually advanced clock.
+type testClock struct {
+	t time.Time
+}
+
+func (c *testClock) now() time.Time          { return c.t }
+func (c *testClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// newTestPool returns a pool of connections to s with the given settings
+// and a manual clock.
+func newTestPool(t *testing.T, s *bolttest.Server, config Config) (*pool, *testClock) {
+	t.Helper()
+
+	d, err := NewDriver("bolt://"+s.Addr(), func(c *Config) { c.Dial = s.Dial })
+	if err != nil {
+		t.Fatalf("NewDriver() error = %v", err)
+	}
+
+	clock := &testClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	p := newPool(config, d.connect)
+	p.now = clock.now
+	t.Cleanup(func() { p.close() })
+
+	return p, clock
+}
+
+func TestPool_reuse(t *testing.T) {
+	ctx := context.Background()
+	s := bolttest.NewServer(nil)
+	t.Cleanup(s.Close)
+	p, _ := newTestPool(t, s, Config{MaxConnectionPoolSize: 2})
+
+	c1, err := p.acquire(ctx, s.Addr())
+	if err != nil {
+		t.Fatalf("pool.acquire() error = %v", err)
+	}
+	p.release(c1)
+
+	c2, err := p.acquire(ctx, s.Addr())
+	if err != nil {
+		t.Fatalf("pool.acquire() error = %v", err)
+	}
+	if c1 != c2 {
+		t.Errorf("pool.acquire() did not reuse the idle connection")
+	}
+
+	want := PoolMetrics{InUse: 1, Created: 1}
+	if got := p.metrics()[s.Addr()]; got != want {
+		t.Errorf("pool.metrics() = %+v, want %+v", got, want)
+	}
+
+	p.release(c2)
+	want = PoolMetrics{Idle: 1, Created: 1}
+	if got := p.metrics()[s.Addr()]; got != want {
+		t.Errorf("pool.metrics() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPool_maxSize(t *testing.T) {
+	ctx := context.Background()
+	s := bolttest.NewServer(nil)
+	t.Cleanup(s.Close)
+	p, _ := newTestPool(t, s, Config{MaxConnectionPoolSize: 1})
+
+	c1, err := p.acquire(ctx, s.Addr())
+	if err != nil {
+		t.Fatalf("pool.acquire() error = %v", err)
+	}
+
+	type result struct {
+		c   *pooledConn
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		c, err := p.acquire(ctx, s.Addr())
+		done <- result{c, err}
+	}()
+
+	for p.metrics()[s.Addr()].Waiters != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	p.release(c1)
+
+	r := <-done
+	if r.err != nil {
+		t.Fatalf("pool.acquire() error = %v", r.err)
+	}
+	if r.c != c1 {
+		t.Errorf("pool.acquire() did not hand over the released connection")
+	}
+
+	want := PoolMetrics{InUse: 1, Created: 1}
+	if got := p.metrics()[s.Addr()]; got != want {
+		t.Errorf("pool.metrics() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPool_acquisitionTimeout(t *testing.T) {
+	ctx := context.Background()
+	s := bolttest.NewServer(nil)
+	t.Cleanup(s.Close)
+	p, _ := newTestPool(t, s, Config{MaxConnectionPoolSize: 1, ConnectionAcquisitionTimeout: 20 * time.Millisecond})
+
+	if _, err := p.acquire(ctx, s.Addr()); err != nil {
+		t.Fatalf("pool.acquire() error = %v", err)
+	}
+
+	_, err := p.acquire(ctx, s.Addr())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("pool.acquire() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if got := p.metrics()[s.Addr()].Waiters; got != 0 {
+		t.Errorf("pool.metrics() Waiters = %d, want 0", got)
+	}
+}
+
+func TestPool_maxLifetime(t *testing.T) {
+	ctx := context.Background()
+	s := bolttest.NewServer(nil)
+	t.Cleanup(s.Close)
+	p, clock := newTestPool(t, s, Config{MaxConnectionLifetime: time.Hour})
+
+	c1, err := p.acquire(ctx, s.Addr())
+	if err != nil {
+		t.Fatalf("pool.acquire() error = %v", err)
+	}
+	p.release(c1)
+
+	clock.advance(time.Hour)
+
+	c2, err := p.acquire(ctx, s.Addr())
+	if err != nil {
+		t.Fatalf("pool.acquire() error = %v", err)
+	}
+	if c1 == c2 {
+		t.Errorf("pool.acquire() reused an expired connection")
+	}
+	if c1.State() != bolt.Defunct {
+		t.Errorf("expired Conn.State() = %v, want %v", c1.State(), bolt.Defunct)
+	}
+
+	want := PoolMetrics{InUse: 1, Created: 2, Closed: 1}
+	if got := p.metrics()[s.Addr()]; got != want {
+		t.Errorf("pool.metrics() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPool_livenessCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		idle      time.Duration
+		drop      bool
+		wantReset bool
+		wantReuse bool
+	}{
+		{
+			name:      "recently used",
+			idle:      time.Second,
+			wantReset: false,
+			wantReuse: true,
+		},
+		{
+			name:      "idle and alive",
+			idle:      time.Minute,
+			wantReset: true,
+			wantReuse: true,
+		},
+		{
+			name:      "idle and dropped",
+			idle:      time.Minute,
+			drop:      true,
+			wantReset: false,
+			wantReuse: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			rec := &recorder{}
+			s := bolttest.NewServer(rec.handle)
+			t.Cleanup(s.Close)
+			p, clock := newTestPool(t, s, Config{IdleLivenessCheck: 30 * time.Second})
+
+			c1, err := p.acquire(ctx, s.Addr())
+			if err != nil {
+				t.Fatalf("pool.acquire() error = %v", err)
+			}
+			p.release(c1)
+
+			if tt.drop {
+				s.CloseClientConnections()
+			}
+			clock.advance(tt.idle)
+
+			c2, err := p.acquire(ctx, s.Addr())
+			if err != nil {
+				t.Fatalf("pool.acquire() error = %v", err)
+			}
+			if (c1 == c2) != tt.wantReuse {
+				t.Errorf("pool.acquire() reused = %v, want %v", c1 == c2, tt.wantReuse)
+			}
+
+			reset := false
+			for _, req := range rec.requests() {
+				if _, ok := req.(bolt.Reset); ok {
+					reset = true
+				}
+			}
+			if reset != tt.wantReset {
+				t.Errorf("RESET sent = %v, want %v", reset, tt.wantReset)
+			}
+		})
+	}
+}
+
+func TestPool_releaseDefunct(t *testing.T) {
+	ctx := context.Background()
+	s := bolttest.NewServer(nil)
+	t.Cleanup(s.Close)
+	p, _ := newTestPool(t, s, Config{})
+
+	c, err := p.acquire(ctx, s.Addr())
+	if err != nil {
+		t.Fatalf("pool.acquire() error = %v", err)
+	}
+	c.Close()
+	p.release(c)
+
+	want := PoolMetrics{Created: 1, Closed: 1}
+	if got := p.metrics()[s.Addr()]; got != want {
+		t.Errorf("pool.metrics() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPool_close(t *testing.T) {
+	ctx := context.Background()
+	s := bolttest.NewServer(nil)
+	t.Cleanup(s.Close)
+	p, _ := newTestPool(t, s, Config{})
+
+	idle, err := p.acquire(ctx, s.Addr())
+	if err != nil {
+		t.Fatalf("pool.acquire() error = %v", err)
+	}
+	inUse, err := p.acquire(ctx, s.Addr())
+	if err != nil {
+		t.Fatalf("pool.acquire() error = %v", err)
+	}
+	p.release(idle)
+
+	p.close()
+	if idle.State() != bolt.Defunct {
+		t.Errorf("idle Conn.State() = %v, want %v", idle.State(), bolt.Defunct)
+	}
+
+	p.release(inUse)
+	if inUse.State() != bolt.Defunct {
+		t.Errorf("released Conn.State() = %v, want %v", inUse.State(), bolt.Defunct)
+	}
+
+	if _, err := p.acquire(ctx, s.Addr()); err != ErrDriverClosed {
+		t.Errorf("pool.acquire() error = %v, want %v", err, ErrDriverClosed)
+	}
+}
+
+func TestDriver_concurrentSessions(t *testing.T) {
+	const maxSize = 3
+
+	ctx := context.Background()
+	// Each connection needs its own query state, so PULL returns everything.
+	s := bolttest.NewServer(func(req bolt.Message) []bolt.Message {
+		if _, ok := req.(bolt.Pull); ok {
+			return []bolt.Message{bolt.Record{Data: packstream.List{int64(1)}}, bolt.Success{}}
+		}
+		return nil
+	})
+	t.Cleanup(s.Close)
+
+	d, err := NewDriver("bolt://"+s.Addr(), func(c *Config) {
+		c.Dial = s.Dial
+		c.MaxConnectionPoolSize = maxSize
+	})
+	if err != nil {
+		t.Fatalf("NewDriver() error = %v", err)
+	}
+	defer d.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			sess := d.NewSession(SessionConfig{})
+			defer sess.Close(ctx)
+
+			for j := 0; j < 10; j++ {
+				res, err := sess.Run(ctx, "RETURN 1", nil)
+				if err != nil {
+					t.Errorf("Session.Run() error = %v", err)
+					return
+				}
+				for res.Next(ctx) {
+				}
+				if err := res.Err(); err != nil {
+					t.Errorf("Result.Err() = %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	m := d.PoolMetrics()[d.addr]
+	if m.InUse != 0 || m.Waiters != 0 {
+		t.Errorf("PoolMetrics() = %+v, want no connections in use", m)
+	}
+	if m.Created > maxSize {
+		t.Errorf("PoolMetrics() Created = %d, want at most %d", m.Created, maxSize)
+	}
+}
@@ -0,0 +1,142 @@
+package graphdb
+
+import (
+	"fmt"
+
+	"github.com/mattmeyers/graphdb/packstream"
+)
+
+// Record is a record of a result. Values holds a value for each key, in the
+// order of Keys.
+type Record struct {
+	Keys   []string
+	Values packstream.List
+}
+
+// Get returns the value of key and whether the record has the key.
+func (r *Record) Get(key string) (interface{}, bool) {
+	for i, k := range r.Keys {
+		if k == key && i < len(r.Values) {
+			return r.Values[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// GetNode returns the value of key, which must be a node.
+func (r *Record) GetNode(key string) (packstream.Node, error) {
+	var n packstream.Node
+	err := r.get(key, "a node", func(v interface{}) (ok bool) {
+		n, ok = v.(packstream.Node)
+		return ok
+	})
+
+	return n, err
+}
+
+// GetRelationship returns the value of key, which must be a relationship.
+func (r *Record) GetRelationship(key string) (packstream.Relationship, error) {
+	var rel packstream.Relationship
+	err := r.get(key, "a relationship", func(v interface{}) (ok bool) {
+		rel, ok = v.(packstream.Relationship)
+		return ok
+	})
+
+	return rel, err
+}
+
+// GetPath returns the value of key, which must be a path.
+func (r *Record) GetPath(key string) (packstream.Path, error) {
+	var p packstream.Path
+	err := r.get(key, "a path", func(v interface{}) (ok bool) {
+		p, ok = v.(packstream.Path)
+		return ok
+	})
+
+	return p, err
+}
+
+// GetInt returns the value of key, which must be an integer.
+func (r *Record) GetInt(key string) (int64, error) {
+	var i int64
+	err := r.get(key, "an integer", func(v interface{}) (ok bool) {
+		i, ok = v.(int64)
+		return ok
+	})
+
+	return i, err
+}
+
+// GetFloat returns the value of key, which must be a float.
+func (r *Record) GetFloat(key string) (float64, error) {
+	var f float64
+	err := r.get(key, "a float", func(v interface{}) (ok bool) {
+		f, ok = v.(float64)
+		return ok
+	})
+
+	return f, err
+}
+
+// GetBool returns the value of key, which must be a boolean.
+func (r *Record) GetBool(key string) (bool, error) {
+	var b bool
+	err := r.get(key, "a boolean", func(v interface{}) (ok bool) {
+		b, ok = v.(bool)
+		return ok
+	})
+
+	return b, err
+}
+
+// GetString returns the value of key, which must be a string.
+func (r *Record) GetString(key string) (string, error) {
+	var s string
+	err := r.get(key, "a string", func(v interface{}) (ok bool) {
+		s, ok = v.(string)
+		return ok
+	})
+
+	return s, err
+}
+
+// get passes the value of key to set, which reports whether the value is
+// of the expected kind.
+func (r *Record) get(key, kind string, set func(v interface{}) bool) error {
+	v, ok := r.Get(key)
+	if !ok {
+		return fmt.Errorf("graphdb: record has no key %q", key)
+	}
+	if !set(v) {
+		return fmt.Errorf("graphdb: value of %q is %T, not %s", key, v, kind)
+	}
+
+	return nil
+}
+
+// Scan stores the values of the record in the struct or map pointed to by
+// v, as if the record were a packstream Dictionary decoded by
+// packstream.Unmarshal. Struct fields are matched to keys by their
+// packstream tag or case-insensitively by name, and keys without a
+// matching field are ignored.
+//
+//	var person struct {
+//		Name string `packstream:"p.name"`
+//		Age  int    `packstream:"p.age"`
+//	}
+//	err := record.Scan(&person)
+func (r *Record) Scan(v interface{}) error {
+	d := make(packstream.Dictionary, len(r.Keys))
+	for i, k := range r.Keys {
+		if i < len(r.Values) {
+			d[k] = r.Values[i]
+		}
+	}
+
+	if err := packstream.Assign(v, d); err != nil {
+		return fmt.Errorf("graphdb: scanning record: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package graphdb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mattmeyers/graphdb/packstream"
+)
+
+var (
+	testNode = packstream.Node{ID: 1, Labels: packstream.List{"Person"}, Properties: packstream.Dictionary{"name": "Alice", "age": int64(42)}}
+	testRel  = packstream.Relationship{ID: 2, StartNodeID: 1, EndNodeID: 3, Type: "KNOWS", Properties: packstream.Dictionary{}}
+	testPath = packstream.Path{Nodes: packstream.List{testNode}, Rels: packstream.List{}, IDs: packstream.List{}}
+)
+
+func testRecord() *Record {
+	return &Record{
+		Keys:   []string{"n", "r", "p", "count", "score", "active", "name", "missing"},
+		Values: packstream.List{testNode, testRel, testPath, int64(7), 0.5, true, "Alice", nil},
+	}
+}
+
+func TestRecord_Get(t *testing.T) {
+	r := testRecord()
+
+	tests := []struct {
+		name   string
+		key    string
+		want   interface{}
+		wantOK bool
+	}{
+		{name: "value", key: "count", want: int64(7), wantOK: true},
+		{name: "null", key: "missing", want: nil, wantOK: true},
+		{name: "unknown key", key: "other", want: nil, wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := r.Get(tt.key)
+			if ok != tt.wantOK {
+				t.Errorf("Record.Get() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Record.Get() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecord_typedGetters(t *testing.T) {
+	r := testRecord()
+
+	tests := []struct {
+		name    string
+		get     func() (interface{}, error)
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name: "node",
+			get:  func() (interface{}, error) { return r.GetNode("n") },
+			want: testNode,
+		},
+		{
+			name: "relationship",
+			get:  func() (interface{}, error) { return r.GetRelationship("r") },
+			want: testRel,
+		},
+		{
+			name: "path",
+			get:  func() (interface{}, error) { return r.GetPath("p") },
+			want: testPath,
+		},
+		{
+			name: "int",
+			get:  func() (interface{}, error) { return r.GetInt("count") },
+			want: int64(7),
+		},
+		{
+			name: "float",
+			get:  func() (interface{}, error) { return r.GetFloat("score") },
+			want: 0.5,
+		},
+		{
+			name: "bool",
+			get:  func() (interface{}, error) { return r.GetBool("active") },
+			want: true,
+		},
+		{
+			name: "string",
+			get:  func() (interface{}, error) { return r.GetString("name") },
+			want: "Alice",
+		},
+		{
+			name:    "wrong type",
+			get:     func() (interface{}, error) { return r.GetInt("name") },
+			want:    int64(0),
+			wantErr: true,
+		},
+		{
+			name:    "null",
+			get:     func() (interface{}, error) { return r.GetString("missing") },
+			want:    "",
+			wantErr: true,
+		},
+		{
+			name:    "unknown key",
+			get:     func() (interface{}, error) { return r.GetNode("other") },
+			want:    packstream.Node{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.get()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecord_Scan(t *testing.T) {
+	type person struct {
+		Name string `packstream:"name"`
+		Age  int    `packstream:"age"`
+	}
+
+	type row struct {
+		Person  person                  `packstream:"n"`
+		Rel     packstream.Relationship `packstream:"r"`
+		Count   int                     `packstream:"count"`
+		Score   float64
+		Active  bool
+		Missing *string
+		Other   string
+	}
+
+	var got row
+	if err := testRecord().Scan(&got); err != nil {
+		t.Fatalf("Record.Scan() error = %v", err)
+	}
+
+	want := row{
+		Person: person{Name: "Alice", Age: 42},
+		Rel:    testRel,
+		Count:  7,
+		Score:  0.5,
+		Active: true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Record.Scan() = %+v, want %+v", got, want)
+	}
+
+	var wrong struct {
+		Name int `packstream:"name"`
+	}
+	err := testRecord().Scan(&wrong)
+	if err == nil || !strings.Contains(err.Error(), "field name") {
+		t.Errorf("Record.Scan() error = %v, want an error naming the field", err)
+	}
+
+	if err := testRecord().Scan(wrong); err == nil {
+		t.Error("Record.Scan() expected error for non-pointer value")
+	}
+}
@@ -0,0 +1,196 @@
+package graphdb
+
+import (
+	"context"
+
+	"github.com/mattmeyers/graphdb/bolt"
+	"github.com/mattmeyers/graphdb/packstream"
+)
+
+// DefaultFetchSize is the number of records requested per PULL unless
+// configured otherwise.
+const DefaultFetchSize = 1000
+
+// Result is a cursor over the records of a query. Records are pulled from the
+// server lazily in batches, so only one batch is held in memory at a time.
+//
+//	for res.Next(ctx) {
+//		name, err := res.Record().GetString("name")
+//		...
+//	}
+//	if err := res.Err(); err != nil {
+//		...
+//	}
+type Result struct {
+	conn      *bolt.Conn
+	keys      []string
+	fetchSize int64
+
+	// run is the metadata of the SUCCESS to RUN.
+	run packstream.Dictionary
+
+	record   packstream.List
+	buffered []packstream.List
+	pulling  bool
+	summary  packstream.Dictionary
+	err      error
+
+	// onDone is called once the connection is no longer needed, with the
+	// error that ended the result, if any.
+	onDone func(ctx context.Context, err error)
+}
+
+// runQuery sends RUN on conn and returns a cursor over its records. A
+// fetchSize of -1 pulls all records at once.
+func runQuery(ctx context.Context, conn *bolt.Conn, query string, params, extra packstream.Dictionary, fetchSize int64) (*Result, error) {
+	meta, err := conn.Run(ctx, query, params, extra)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, _ := meta["fields"].(packstream.List)
+	keys := make([]string, len(fields))
+	for i, f := range fields {
+		keys[i], _ = f.(string)
+	}
+
+	return &Result{conn: conn, keys: keys, fetchSize: fetchSize, run: meta}, nil
+}
+
+// Keys returns the names of the fields of each record.
+func (r *Result) Keys() []string {
+	return r.keys
+}
+
+// Next advances to the next record, pulling a new batch from the server when
+// the current one is exhausted. It returns false when there are no more
+// records or an error occurred, which is then returned by Err.
+func (r *Result) Next(ctx context.Context) bool {
+	if len(r.buffered) > 0 {
+		r.record, r.buffered = r.buffered[0], r.buffered[1:]
+		return true
+	}
+
+	r.record = r.fetch(ctx)
+	if r.record == nil {
+		r.finish(ctx)
+		return false
+	}
+
+	return true
+}
+
+// fetch reads the next record from the connection, or returns nil once the
+// result is complete or failed.
+func (r *Result) fetch(ctx context.Context) packstream.List {
+	if r.done() {
+		return nil
+	}
+
+	for {
+		if !r.pulling {
+			if r.err = r.conn.Pull(ctx, r.fetchSize, -1); r.err != nil {
+				return nil
+			}
+			r.pulling = true
+		}
+
+		values, meta, err := r.conn.Fetch(ctx)
+		if err != nil {
+			r.err = err
+			return nil
+		}
+
+		if meta == nil {
+			return values
+		}
+
+		r.pulling = false
+		if hasMore, _ := meta["has_more"].(bool); !hasMore {
+			r.summary = meta
+			return nil
+		}
+	}
+}
+
+// buffer reads the remaining records into memory so that the connection
+// can be used for another request.
+func (r *Result) buffer(ctx context.Context) error {
+	for values := r.fetch(ctx); values != nil; values = r.fetch(ctx) {
+		r.buffered = append(r.buffered, values)
+	}
+	r.finish(ctx)
+
+	return r.err
+}
+
+// finish calls onDone once the result is complete or failed.
+func (r *Result) finish(ctx context.Context) {
+	if r.onDone != nil {
+		f := r.onDone
+		r.onDone = nil
+		f(ctx, r.err)
+	}
+}
+
+// done reports whether the connection is no longer streaming the result.
+func (r *Result) done() bool {
+	return r.summary != nil || r.err != nil
+}
+
+// Record returns the current record, or nil if there is none.
+func (r *Result) Record() *Record {
+	if r.record == nil {
+		return nil
+	}
+
+	return &Record{Keys: r.keys, Values: r.record}
+}
+
+// Err returns the error, if any, that ended the iteration.
+func (r *Result) Err() error {
+	return r.err
+}
+
+// Consume discards the remaining records and returns the summary of the
+// query. Records that have not been pulled yet are dropped by the server
+// with DISCARD instead of being sent.
+func (r *Result) Consume(ctx context.Context) (*ResultSummary, error) {
+	r.record, r.buffered = nil, nil
+	r.discard(ctx)
+	r.finish(ctx)
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return parseSummary(r.run, r.summary), nil
+}
+
+// discard reads the responses to the outstanding PULL, if any, and drops
+// the remaining records with DISCARD.
+func (r *Result) discard(ctx context.Context) {
+	for !r.done() {
+		if !r.pulling {
+			if r.err = r.conn.Discard(ctx, -1, -1); r.err != nil {
+				return
+			}
+			r.pulling = true
+		}
+
+		_, meta, err := r.conn.Fetch(ctx)
+		if err != nil {
+			r.err = err
+			return
+		}
+
+		if meta == nil {
+			continue
+		}
+
+		r.pulling = false
+		if hasMore, _ := meta["has_more"].(bool); !hasMore {
+			r.summary = meta
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package graphdb
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/mattmeyers/graphdb/bolt"
+	"github.com/mattmeyers/graphdb/bolt/bolttest"
+	"github.com/mattmeyers/graphdb/packstream"
+)
+
+// fakeQuery answers every RUN with keys and serves its records in batches of
+// the size requested by PULL. DISCARD drops the remaining records.
+type fakeQuery struct {
+	keys    packstream.List
+	records []packstream.List
+	fail    bool
+
+	mu        sync.Mutex
+	remaining []packstream.List
+	pulls     []int64
+	discards  int
+}
+
+func (q *fakeQuery) handle(req bolt.Message) []bolt.Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	switch req := req.(type) {
+	case bolt.Run:
+		q.remaining = q.records
+		return []bolt.Message{bolt.Success{Metadata: packstream.Dictionary{"fields": q.keys}}}
+	case bolt.Pull:
+		n, _ := req.Extra["n"].(int64)
+		q.pulls = append(q.pulls, n)
+		if n < 0 || n > int64(len(q.remaining)) {
+			n = int64(len(q.remaining))
+		}
+
+		var resps []bolt.Message
+		for _, r := range q.remaining[:n] {
+			resps = append(resps, bolt.Record{Data: r})
+		}
+		q.remaining = q.remaining[n:]
+
+		if q.fail {
+			return append(resps, bolt.Failure{Metadata: packstream.Dictionary{
+				"code":    "Neo.ClientError.Statement.ArithmeticError",
+				"message": "/ by zero",
+			}})
+		}
+		if len(q.remaining) > 0 {
+			return append(resps, bolt.Success{Metadata: packstream.Dictionary{"has_more": true}})
+		}
+		return append(resps, bolt.Success{Metadata: packstream.Dictionary{"type": "r"}})
+	case bolt.Discard:
+		q.discards++
+		q.remaining = nil
+		return []bolt.Message{bolt.Success{Metadata: packstream.Dictionary{"type": "r"}}}
+	}
+	return nil
+}
+
+// connect starts a fake server with handler h and returns an initialized
+// connection to it.
+func connect(t *testing.T, h bolttest.Handler) *bolt.Conn {
+	t.Helper()
+
+	s := bolttest.NewServer(h)
+	t.Cleanup(s.Close)
+
+	ctx := context.Background()
+	nc, err := s.Dial(ctx, "tcp", s.Addr())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+
+	c, err := bolt.NewConn(ctx, nc)
+	if err != nil {
+		t.Fatalf("NewConn() error = %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	if _, err := c.Hello(ctx, nil, packstream.Dictionary{"scheme": "none"}); err != nil {
+		t.Fatalf("Conn.Hello() error = %v", err)
+	}
+
+	return c
+}
+
+func records(n int) []packstream.List {
+	l := make([]packstream.List, n)
+	for i := range l {
+		l[i] = packstream.List{int64(i)}
+	}
+	return l
+}
+
+func TestResult_Next(t *testing.T) {
+	tests := []struct {
+		name      string
+		records   []packstream.List
+		fetchSize int64
+		wantPulls []int64
+	}{
+		{
+			name:      "single batch",
+			records:   records(3),
+			fetchSize: 10,
+			wantPulls: []int64{10},
+		},
+		{
+			name:      "several batches",
+			records:   records(5),
+			fetchSize: 2,
+			wantPulls: []int64{2, 2, 2},
+		},
+		{
+			name:      "fetch all",
+			records:   records(5),
+			fetchSize: -1,
+			wantPulls: []int64{-1},
+		},
+		{
+			name:      "empty result",
+			records:   nil,
+			fetchSize: 2,
+			wantPulls: []int64{2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			q := &fakeQuery{keys: packstream.List{"n"}, records: tt.records}
+			conn := connect(t, q.handle)
+
+			res, err := runQuery(ctx, conn, "UNWIND range(0, 4) AS n RETURN n", nil, nil, tt.fetchSize)
+			if err != nil {
+				t.Fatalf("runQuery() error = %v", err)
+			}
+			if want := []string{"n"}; !reflect.DeepEqual(res.Keys(), want) {
+				t.Errorf("Result.Keys() = %v, want %v", res.Keys(), want)
+			}
+
+			var got []packstream.List
+			for res.Next(ctx) {
+				got = append(got, res.Record().Values)
+			}
+			if err := res.Err(); err != nil {
+				t.Fatalf("Result.Err() = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.records) {
+				t.Errorf("Result.Record() = %v, want %v", got, tt.records)
+			}
+
+			summary, err := res.Consume(ctx)
+			if err != nil {
+				t.Fatalf("Result.Consume() error = %v", err)
+			}
+			if summary.QueryType != QueryTypeRead {
+				t.Errorf("Result.Consume() = %v, want type r", summary)
+			}
+
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			if !reflect.DeepEqual(q.pulls, tt.wantPulls) {
+				t.Errorf("PULL sizes = %v, want %v", q.pulls, tt.wantPulls)
+			}
+			if conn.State() != bolt.Ready {
+				t.Errorf("Conn.State() = %v, want %v", conn.State(), bolt.Ready)
+			}
+		})
+	}
+}
+
+func TestResult_Consume(t *testing.T) {
+	tests := []struct {
+		name         string
+		read         int
+		wantPulls    []int64
+		wantDiscards int
+	}{
+		{
+			name:         "before reading",
+			read:         0,
+			wantPulls:    nil,
+			wantDiscards: 1,
+		},
+		{
+			name:         "within a batch",
+			read:         1,
+			wantPulls:    []int64{2},
+			wantDiscards: 1,
+		},
+		{
+			name:         "after several batches",
+			read:         3,
+			wantPulls:    []int64{2, 2},
+			wantDiscards: 1,
+		},
+		{
+			name:         "after last batch",
+			read:         5,
+			wantPulls:    []int64{2, 2, 2},
+			wantDiscards: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			q := &fakeQuery{keys: packstream.List{"n"}, records: records(5)}
+			conn := connect(t, q.handle)
+
+			res, err := runQuery(ctx, conn, "UNWIND range(0, 4) AS n RETURN n", nil, nil, 2)
+			if err != nil {
+				t.Fatalf("runQuery() error = %v", err)
+			}
+
+			for i := 0; i < tt.read; i++ {
+				if !res.Next(ctx) {
+					t.Fatalf("Result.Next() = false, err = %v", res.Err())
+				}
+			}
+
+			if _, err := res.Consume(ctx); err != nil {
+				t.Fatalf("Result.Consume() error = %v", err)
+			}
+			if res.Next(ctx) {
+				t.Errorf("Result.Next() after Consume = true")
+			}
+
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			if !reflect.DeepEqual(q.pulls, tt.wantPulls) {
+				t.Errorf("PULL sizes = %v, want %v", q.pulls, tt.wantPulls)
+			}
+			if q.discards != tt.wantDiscards {
+				t.Errorf("DISCARD count = %d, want %d", q.discards, tt.wantDiscards)
+			}
+			if conn.State() != bolt.Ready {
+				t.Errorf("Conn.State() = %v, want %v", conn.State(), bolt.Ready)
+			}
+		})
+	}
+}
+
+func TestResult_Err(t *testing.T) {
+	ctx := context.Background()
+	q := &fakeQuery{keys: packstream.List{"n"}, records: records(2), fail: true}
+	conn := connect(t, q.handle)
+
+	res, err := runQuery(ctx, conn, "UNWIND [1, 0] AS n RETURN 1 / n", nil, nil, 10)
+	if err != nil {
+		t.Fatalf("runQuery() error = %v", err)
+	}
+
+	n := 0
+	for res.Next(ctx) {
+		n++
+	}
+	if n != 2 {
+		t.Errorf("Result.Next() returned %d records, want 2", n)
+	}
+
+	if _, ok := res.Err().(*bolt.Neo4jError); !ok {
+		t.Errorf("Result.Err() = %v, want *bolt.Neo4jError", res.Err())
+	}
+	if _, err := res.Consume(ctx); err != res.Err() {
+		t.Errorf("Result.Consume() error = %v, want %v", err, res.Err())
+	}
+	if conn.State() != bolt.Failed {
+		t.Errorf("Conn.State() = %v, want %v", conn.State(), bolt.Failed)
+	}
+}
@@ -0,0 +1,193 @@
+package graphdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/mattmeyers/graphdb/bolt"
+)
+
+// DefaultMaxTransactionRetryTime is the time after which managed
+// transactions stop being retried unless configured otherwise.
+const DefaultMaxTransactionRetryTime = 30 * time.Second
+
+// TxWork is a unit of work run by ExecuteRead and ExecuteWrite. It may be
+// called several times and must not commit or roll back tx itself.
+type TxWork func(tx *Tx) (interface{}, error)
+
+// retryPolicy decides how long to wait between attempts of a managed
+// transaction.
+type retryPolicy struct {
+	maxRetryTime time.Duration
+	initialDelay time.Duration
+	multiplier   float64
+	jitter       float64
+
+	// sleep waits for d or until ctx is done. It is replaced in tests.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func newRetryPolicy(maxRetryTime time.Duration) retryPolicy {
+	return retryPolicy{
+		maxRetryTime: maxRetryTime,
+		initialDelay: time.Second,
+		multiplier:   2,
+		jitter:       0.2,
+		sleep:        sleep,
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// delay returns the wait before the given retry, counting from 0, with
+// jitter applied.
+func (p retryPolicy) delay(retry int) time.Duration {
+	d := float64(p.initialDelay)
+	for i := 0; i < retry; i++ {
+		d *= p.multiplier
+	}
+
+	d += d * p.jitter * (2*rand.Float64() - 1)
+
+	return time.Duration(d)
+}
+
+// ExecuteRead runs work in a read transaction and commits it, retrying the
+// whole unit of work on transient failures. The value returned by the last
+// call of work is returned.
+func (s *Session) ExecuteRead(ctx context.Context, work TxWork, configurers ...func(*TxConfig)) (interface{}, error) {
+	return s.execute(ctx, AccessModeRead, work, configurers)
+}
+
+// ExecuteWrite runs work in a write transaction and commits it, retrying the
+// whole unit of work on transient failures. The value returned by the last
+// call of work is returned.
+func (s *Session) ExecuteWrite(ctx context.Context, work TxWork, configurers ...func(*TxConfig)) (interface{}, error) {
+	return s.execute(ctx, AccessModeWrite, work, configurers)
+}
+
+func (s *Session) execute(ctx context.Context, mode AccessMode, work TxWork, configurers []func(*TxConfig)) (interface{}, error) {
+	p := s.driver.retry
+	start := time.Now()
+
+	for retry := 0; ; retry++ {
+		s.authErr = nil
+		v, err := s.executeOnce(ctx, mode, work, configurers)
+		if err == nil {
+			return v, nil
+		}
+
+		// Security errors can be retried once the token has been renewed.
+		if !isRetryable(err) && (s.authErr == nil || !errors.Is(err, s.authErr)) {
+			return nil, err
+		}
+
+		remaining := p.maxRetryTime - time.Since(start)
+		if remaining <= 0 {
+			return nil, fmt.Errorf("graphdb: transaction failed after %d attempts: %w", retry+1, err)
+		}
+
+		// The last attempt is made when the retry time runs out rather than
+		// after it.
+		d := p.delay(retry)
+		if d > remaining {
+			d = remaining
+		}
+
+		if serr := p.sleep(ctx, d); serr != nil {
+			return nil, serr
+		}
+	}
+}
+
+func (s *Session) executeOnce(ctx context.Context, mode AccessMode, work TxWork, configurers []func(*TxConfig)) (interface{}, error) {
+	tx, err := s.beginTransaction(ctx, mode, configurers)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := work(tx)
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// isRetryable reports whether a unit of work that failed with err can be
+// safely run again.
+func isRetryable(err error) bool {
+	var uce *UnknownCommitError
+	if errors.As(err, &uce) {
+		return false
+	}
+
+	if isLeaderSwitch(err) || bolt.IsTransient(err) {
+		return true
+	}
+
+	return isConnectivityError(err)
+}
+
+// isLeaderSwitch reports whether err was caused by writing to a server that
+// is no longer the leader of a cluster.
+func isLeaderSwitch(err error) bool {
+	var ne *bolt.Neo4jError
+	if !errors.As(err, &ne) {
+		return false
+	}
+
+	switch ne.Code {
+	case "Neo.ClientError.Cluster.NotALeader",
+		"Neo.ClientError.General.ForbiddenOnReadOnlyDatabase":
+		return true
+	}
+
+	return false
+}
+
+// isConnectivityError reports whether err was caused by a connection that
+// was lost or could not be established, including one that was lost in the
+// middle of a message.
+func isConnectivityError(err error) bool {
+	var ne *bolt.Neo4jError
+	if errors.As(err, &ne) {
+		return false
+	}
+
+	if isContextError(err) {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, bolt.ErrTruncatedChunk)
+}
+
+// isContextError reports whether err was caused by a context that was
+// cancelled or whose deadline passed.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,313 @@
+package graphdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattmeyers/graphdb/bolt"
+	"github.com/mattmeyers/graphdb/bolt/bolttest"
+	"github.com/mattmeyers/graphdb/packstream"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "transient error",
+			err:  &bolt.Neo4jError{Code: "Neo.TransientError.Transaction.DeadlockDetected"},
+			want: true,
+		},
+		{
+			name: "wrapped transient error",
+			err:  fmt.Errorf("query failed: %w", &bolt.Neo4jError{Code: "Neo.TransientError.General.OutOfMemoryError"}),
+			want: true,
+		},
+		{
+			name: "terminated by client",
+			err:  &bolt.Neo4jError{Code: "Neo.TransientError.Transaction.Terminated"},
+			want: false,
+		},
+		{
+			name: "lock client stopped",
+			err:  &bolt.Neo4jError{Code: "Neo.TransientError.Transaction.LockClientStopped"},
+			want: false,
+		},
+		{
+			name: "not a leader",
+			err:  &bolt.Neo4jError{Code: "Neo.ClientError.Cluster.NotALeader"},
+			want: true,
+		},
+		{
+			name: "read only database",
+			err:  &bolt.Neo4jError{Code: "Neo.ClientError.General.ForbiddenOnReadOnlyDatabase"},
+			want: true,
+		},
+		{
+			name: "client error",
+			err:  &bolt.Neo4jError{Code: "Neo.ClientError.Statement.SyntaxError"},
+			want: false,
+		},
+		{
+			name: "database error",
+			err:  &bolt.Neo4jError{Code: "Neo.DatabaseError.General.UnknownError"},
+			want: false,
+		},
+		{
+			name: "connection closed",
+			err:  io.EOF,
+			want: true,
+		},
+		{
+			name: "truncated message",
+			err:  bolt.ErrTruncatedChunk,
+			want: true,
+		},
+		{
+			name: "wrapped truncated message",
+			err:  fmt.Errorf("reading response: %w", bolt.ErrTruncatedChunk),
+			want: true,
+		},
+		{
+			name: "connection refused",
+			err:  &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+			want: true,
+		},
+		{
+			name: "unknown commit outcome",
+			err:  &UnknownCommitError{Err: io.EOF},
+			want: false,
+		},
+		{
+			name: "context canceled",
+			err:  context.Canceled,
+			want: false,
+		},
+		{
+			name: "user error",
+			err:  errors.New("not found"),
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("isRetryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_delay(t *testing.T) {
+	p := newRetryPolicy(time.Minute)
+
+	for retry, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		for i := 0; i < 100; i++ {
+			got := p.delay(retry)
+			if got < want*8/10 || got > want*12/10 {
+				t.Fatalf("retryPolicy.delay(%d) = %v, want %v ± 20%%", retry, got, want)
+			}
+		}
+	}
+}
+
+// flakyServer fails the given request of the first failures attempts of a
+// transaction, either with a FAILURE carrying code or, if code is empty, by
+// dropping the connection.
+type flakyServer struct {
+	*bolttest.Server
+
+	on       string
+	code     string
+	failures int
+
+	mu       sync.Mutex
+	attempts int
+}
+
+func newFlakyServer(t *testing.T, on, code string, failures int) *flakyServer {
+	s := &flakyServer{on: on, code: code, failures: failures}
+	s.Server = bolttest.NewServer(s.handle)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *flakyServer) handle(req bolt.Message) []bolt.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := req.(bolt.Begin); ok {
+		s.attempts++
+	}
+
+	if requestNames([]bolt.Message{req})[0] != s.on || s.attempts > s.failures {
+		return (&fakeQuery{}).handle(req)
+	}
+
+	if s.code == "" {
+		s.CloseClientConnections()
+		return nil
+	}
+
+	return []bolt.Message{bolt.Failure{Metadata: packstream.Dictionary{"code": s.code, "message": "failed"}}}
+}
+
+func TestSession_ExecuteWrite(t *testing.T) {
+	tests := []struct {
+		name         string
+		on           string
+		code         string
+		failures     int
+		maxRetryTime time.Duration
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			name:         "no failure",
+			on:           "Run",
+			failures:     0,
+			maxRetryTime: time.Minute,
+			wantAttempts: 1,
+			wantErr:      false,
+		},
+		{
+			name:         "transient failures",
+			on:           "Run",
+			code:         "Neo.TransientError.Transaction.DeadlockDetected",
+			failures:     2,
+			maxRetryTime: time.Minute,
+			wantAttempts: 3,
+			wantErr:      false,
+		},
+		{
+			name:         "transient commit failure",
+			on:           "Commit",
+			code:         "Neo.TransientError.Transaction.DeadlockDetected",
+			failures:     1,
+			maxRetryTime: time.Minute,
+			wantAttempts: 2,
+			wantErr:      false,
+		},
+		{
+			name:         "client error",
+			on:           "Run",
+			code:         "Neo.ClientError.Statement.SyntaxError",
+			failures:     1,
+			maxRetryTime: time.Minute,
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "connection dropped before commit",
+			on:           "Run",
+			failures:     1,
+			maxRetryTime: time.Minute,
+			wantAttempts: 2,
+			wantErr:      false,
+		},
+		{
+			name:         "connection dropped during commit",
+			on:           "Commit",
+			failures:     1,
+			maxRetryTime: time.Minute,
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "delay clamped to retry time",
+			on:           "Run",
+			code:         "Neo.TransientError.Transaction.DeadlockDetected",
+			failures:     1,
+			maxRetryTime: 500 * time.Millisecond,
+			wantAttempts: 2,
+			wantErr:      false,
+		},
+		{
+			name:         "retry time exceeded",
+			on:           "Run",
+			code:         "Neo.TransientError.Transaction.DeadlockDetected",
+			failures:     5,
+			maxRetryTime: 0,
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newFlakyServer(t, tt.on, tt.code, tt.failures)
+
+			d, err := NewDriver("bolt://"+s.Addr(), func(c *Config) { c.MaxTransactionRetryTime = tt.maxRetryTime })
+			if err != nil {
+				t.Fatalf("NewDriver() error = %v", err)
+			}
+
+			var delays []time.Duration
+			d.retry.sleep = func(ctx context.Context, d time.Duration) error {
+				delays = append(delays, d)
+				return nil
+			}
+
+			sess := d.NewSession(SessionConfig{})
+			defer sess.Close(ctx)
+
+			calls := 0
+			got, err := sess.ExecuteWrite(ctx, func(tx *Tx) (interface{}, error) {
+				calls++
+				res, err := tx.Run(ctx, "CREATE (n)", nil)
+				if err != nil {
+					return nil, err
+				}
+				if _, err := res.Consume(ctx); err != nil {
+					return nil, err
+				}
+				return calls, nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Session.ExecuteWrite() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.wantAttempts {
+				t.Errorf("Session.ExecuteWrite() = %v, want %v", got, tt.wantAttempts)
+			}
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", s.attempts, tt.wantAttempts)
+			}
+			if len(delays) != tt.wantAttempts-1 {
+				t.Errorf("retry delays = %v, want %d", delays, tt.wantAttempts-1)
+			}
+			for _, d := range delays {
+				if d > tt.maxRetryTime {
+					t.Errorf("retry delay = %v, want at most %v", d, tt.maxRetryTime)
+				}
+			}
+		})
+	}
+}
+
+func TestSession_ExecuteRead(t *testing.T) {
+	ctx := context.Background()
+	rec := &recorder{next: (&fakeQuery{}).handle}
+	sess := newTestDriver(t, rec.handle).NewSession(SessionConfig{})
+	defer sess.Close(ctx)
+
+	if _, err := sess.ExecuteRead(ctx, func(tx *Tx) (interface{}, error) { return nil, nil }); err != nil {
+		t.Fatalf("Session.ExecuteRead() error = %v", err)
+	}
+
+	begin := rec.requests()[0].(bolt.Begin)
+	if begin.Extra["mode"] != "r" {
+		t.Errorf("BEGIN mode = %v, want r", begin.Extra["mode"])
+	}
+}
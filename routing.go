@@ -0,0 +1,293 @@
+package graphdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mattmeyers/graphdb/bolt"
+	"github.com/mattmeyers/graphdb/packstream"
+)
+
+// routingTable lists the servers of a cluster serving a database.
+type routingTable struct {
+	database string
+	routers  []string
+	readers  []string
+	writers  []string
+	expires  time.Time
+
+	// next is used to spread sessions over readers and writers.
+	next int
+}
+
+// parseRoutingTable parses the rt entry of the metadata of a ROUTE SUCCESS.
+func parseRoutingTable(rt packstream.Dictionary, now time.Time) (*routingTable, error) {
+	ttl, ok := rt["ttl"].(int64)
+	if !ok {
+		return nil, errors.New("graphdb: routing table has no ttl")
+	}
+
+	t := &routingTable{expires: now.Add(time.Duration(ttl) * time.Second)}
+	t.database, _ = rt["db"].(string)
+
+	servers, _ := rt["servers"].(packstream.List)
+	for _, s := range servers {
+		server, _ := s.(packstream.Dictionary)
+		addresses, _ := server["addresses"].(packstream.List)
+
+		var addrs []string
+		for _, a := range addresses {
+			if addr, ok := a.(string); ok {
+				addrs = append(addrs, addr)
+			}
+		}
+
+		switch server["role"] {
+		case "ROUTE":
+			t.routers = append(t.routers, addrs...)
+		case "READ":
+			t.readers = append(t.readers, addrs...)
+		case "WRITE":
+			t.writers = append(t.writers, addrs...)
+		}
+	}
+
+	if len(t.routers) == 0 {
+		return nil, errors.New("graphdb: routing table has no routers")
+	}
+
+	return t, nil
+}
+
+// stale reports whether t must be refreshed before serving work in mode.
+func (t *routingTable) stale(now time.Time, mode AccessMode) bool {
+	if !now.Before(t.expires) || len(t.routers) == 0 {
+		return true
+	}
+
+	if mode == AccessModeRead {
+		return len(t.readers) == 0
+	}
+	return len(t.writers) == 0
+}
+
+// remove removes addr from every role of t.
+func (t *routingTable) remove(addr string) {
+	t.routers = without(t.routers, addr)
+	t.readers = without(t.readers, addr)
+	t.writers = without(t.writers, addr)
+}
+
+func without(addrs []string, addr string) []string {
+	out := addrs[:0]
+	for _, a := range addrs {
+		if a != addr {
+			out = append(out, a)
+		}
+	}
+
+	return out
+}
+
+// router keeps a routing table per database of a cluster and picks the
+// servers sessions connect to.
+type router struct {
+	pool *pool
+
+	// seed is the address from the driver's URI, used when no known
+	// router responds.
+	seed    string
+	context packstream.Dictionary
+
+	// now returns the current time. It is replaced in tests.
+	now func() time.Time
+
+	// mu guards tables and refreshes. It is never held while waiting for
+	// a connection or a server, as a session ending its work takes it too.
+	mu        sync.Mutex
+	tables    map[string]*routingTable
+	refreshes map[string]*refreshCall
+}
+
+// refreshCall is a routing table refresh in progress, which concurrent sessions
+// wait for rather than each fetching the same table.
+type refreshCall struct {
+	done chan struct{}
+	err  error
+}
+
+func newRouter(p *pool, seed string, context packstream.Dictionary) *router {
+	return &router{
+		pool:      p,
+		seed:      seed,
+		context:   context,
+		now:       time.Now,
+		tables:    make(map[string]*routingTable),
+		refreshes: make(map[string]*refreshCall),
+	}
+}
+
+// server returns the address of a server for work in mode against database,
+// refreshing its routing table first if needed. An empty database denotes the
+// default database.
+func (r *router) server(ctx context.Context, database string, mode AccessMode, impUser string, bookmarks []string) (string, error) {
+	if err := r.ensureFresh(ctx, database, mode, impUser, bookmarks); err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tables[database]
+	var addrs []string
+	if ok {
+		addrs = t.writers
+		if mode == AccessModeRead {
+			addrs = t.readers
+		}
+	}
+	if len(addrs) == 0 {
+		return "", fmt.Errorf("graphdb: no server available for %s", describeMode(mode))
+	}
+
+	t.next++
+	return addrs[t.next%len(addrs)], nil
+}
+
+func describeMode(mode AccessMode) string {
+	if mode == AccessModeRead {
+		return "reading"
+	}
+	return "writing"
+}
+
+// ensureFresh refreshes the routing table of database unless it can serve
+// work in mode. Only one refresh per database runs at a time, the others
+// wait for its outcome. A table that still has no server for mode after the
+// refresh is left for server to report.
+func (r *router) ensureFresh(ctx context.Context, database string, mode AccessMode, impUser string, bookmarks []string) error {
+	r.mu.Lock()
+	for {
+		t, ok := r.tables[database]
+		if ok && !t.stale(r.now(), mode) {
+			r.mu.Unlock()
+			return nil
+		}
+
+		f, ok := r.refreshes[database]
+		if !ok {
+			break
+		}
+		r.mu.Unlock()
+
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		// A refresh abandoned by the session that started it is run again
+		// for this one.
+		if f.err == nil || !isContextError(f.err) {
+			return f.err
+		}
+		r.mu.Lock()
+	}
+
+	f := &refreshCall{done: make(chan struct{})}
+	r.refreshes[database] = f
+
+	var routers []string
+	if old, ok := r.tables[database]; ok {
+		routers = append(routers, old.routers...)
+	}
+	r.mu.Unlock()
+
+	t, err := r.refresh(ctx, database, impUser, bookmarks, routers)
+
+	r.mu.Lock()
+	if err == nil {
+		r.tables[database] = t
+	}
+	delete(r.refreshes, database)
+	r.mu.Unlock()
+
+	f.err = err
+	close(f.done)
+
+	return err
+}
+
+// refresh fetches a new routing table for database from the given routers,
+// falling back to the seed router.
+func (r *router) refresh(ctx context.Context, database, impUser string, bookmarks []string, routers []string) (*routingTable, error) {
+	routers = append(routers, r.seed)
+
+	var err error
+	for _, addr := range routers {
+		var t *routingTable
+		if t, err = r.fetch(ctx, addr, database, impUser, bookmarks); err == nil {
+			return t, nil
+		}
+
+		// Errors caused by the request itself, e.g. an unknown database,
+		// would be returned by every router.
+		var ne *bolt.Neo4jError
+		if errors.As(err, &ne) && ne.Classification() == bolt.ClientError {
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, fmt.Errorf("graphdb: could not fetch routing table: %w", err)
+}
+
+// fetch requests the routing table of database from the router at addr. The
+// bookmarks make sure the router knows about databases created by them.
+func (r *router) fetch(ctx context.Context, addr, database, impUser string, bookmarks []string) (*routingTable, error) {
+	conn, err := r.pool.acquire(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer r.pool.release(conn)
+
+	extra := packstream.Dictionary{}
+	if database != "" {
+		extra["db"] = database
+	}
+	if impUser != "" {
+		extra["imp_user"] = impUser
+	}
+
+	meta, err := conn.Route(ctx, r.context, stringList(bookmarks), extra)
+	if err != nil {
+		conn.Reset(ctx)
+		return nil, err
+	}
+
+	rt, _ := meta["rt"].(packstream.Dictionary)
+	return parseRoutingTable(rt, r.now())
+}
+
+// handleError updates the routing tables after work against database on the
+// server at addr failed with err.
+func (r *router) handleError(database, addr string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch {
+	case isLeaderSwitch(err):
+		if t, ok := r.tables[database]; ok {
+			t.writers = without(t.writers, addr)
+		}
+	case isConnectivityError(err):
+		for _, t := range r.tables {
+			t.remove(addr)
+		}
+	}
+}
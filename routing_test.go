@@ -0,0 +1,444 @@
+package graphdb
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattmeyers/graphdb/bolt"
+	"github.com/mattmeyers/graphdb/bolt/bolttest"
+	"github.com/mattmeyers/graphdb/packstream"
+)
+
+func TestParseRoutingTable(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		rt      packstream.Dictionary
+		want    *routingTable
+		wantErr bool
+	}{
+		{
+			name: "full table",
+			rt: packstream.Dictionary{
+				"ttl": int64(300),
+				"db":  "neo4j",
+				"servers": packstream.List{
+					packstream.Dictionary{"role": "ROUTE", "addresses": packstream.List{"a:7687", "b:7687"}},
+					packstream.Dictionary{"role": "READ", "addresses": packstream.List{"b:7687"}},
+					packstream.Dictionary{"role": "WRITE", "addresses": packstream.List{"a:7687"}},
+				},
+			},
+			want: &routingTable{
+				database: "neo4j",
+				routers:  []string{"a:7687", "b:7687"},
+				readers:  []string{"b:7687"},
+				writers:  []string{"a:7687"},
+				expires:  now.Add(5 * time.Minute),
+			},
+			wantErr: false,
+		},
+		{
+			name: "no writers",
+			rt: packstream.Dictionary{
+				"ttl": int64(10),
+				"servers": packstream.List{
+					packstream.Dictionary{"role": "ROUTE", "addresses": packstream.List{"a:7687"}},
+				},
+			},
+			want: &routingTable{
+				routers: []string{"a:7687"},
+				expires: now.Add(10 * time.Second),
+			},
+			wantErr: false,
+		},
+		{
+			name: "no routers",
+			rt: packstream.Dictionary{
+				"ttl": int64(10),
+				"servers": packstream.List{
+					packstream.Dictionary{"role": "READ", "addresses": packstream.List{"a:7687"}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "no ttl",
+			rt:      packstream.Dictionary{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRoutingTable(tt.rt, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseRoutingTable() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRoutingTable() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// cluster is a set of fake servers. The router answers ROUTE with the table
+// returned by its table function, and every server records the queries it
+// receives.
+type cluster struct {
+	router  *bolttest.Server
+	servers map[string]*bolttest.Server
+
+	mu      sync.Mutex
+	table   func(db string) packstream.Dictionary
+	routes  []bolt.Route
+	queries map[string][]string
+	fail    map[string]packstream.Dictionary
+}
+
+func newCluster(t *testing.T, names ...string) *cluster {
+	c := &cluster{
+		servers: make(map[string]*bolttest.Server),
+		queries: make(map[string][]string),
+		fail:    make(map[string]packstream.Dictionary),
+	}
+
+	c.router = bolttest.NewServer(c.handler("router"))
+	t.Cleanup(c.router.Close)
+
+	for _, name := range names {
+		s := bolttest.NewServer(c.handler(name))
+		t.Cleanup(s.Close)
+		c.servers[name] = s
+	}
+
+	return c
+}
+
+func (c *cluster) handler(name string) bolttest.Handler {
+	return func(req bolt.Message) []bolt.Message {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		switch req := req.(type) {
+		case bolt.Route:
+			c.routes = append(c.routes, req)
+			db, _ := req.Extra["db"].(string)
+			return []bolt.Message{bolt.Success{Metadata: packstream.Dictionary{"rt": c.table(db)}}}
+		case bolt.Run:
+			c.queries[name] = append(c.queries[name], req.Query)
+			if f, ok := c.fail[name]; ok {
+				return []bolt.Message{bolt.Failure{Metadata: f}}
+			}
+			return []bolt.Message{bolt.Success{Metadata: packstream.Dictionary{"fields": packstream.List{}}}}
+		}
+		return nil
+	}
+}
+
+// rt returns a routing table with the router of c and the named servers as
+// readers and writers.
+func (c *cluster) rt(ttl int64, readers, writers []string) packstream.Dictionary {
+	addrs := func(names []string) packstream.List {
+		l := packstream.List{}
+		for _, n := range names {
+			l = append(l, c.servers[n].Addr())
+		}
+		return l
+	}
+
+	return packstream.Dictionary{
+		"ttl": ttl,
+		"servers": packstream.List{
+			packstream.Dictionary{"role": "ROUTE", "addresses": packstream.List{c.router.Addr()}},
+			packstream.Dictionary{"role": "READ", "addresses": addrs(readers)},
+			packstream.Dictionary{"role": "WRITE", "addresses": addrs(writers)},
+		},
+	}
+}
+
+func (c *cluster) driver(t *testing.T, query string) *Driver {
+	d, err := NewDriver("neo4j://" + c.router.Addr() + query)
+	if err != nil {
+		t.Fatalf("NewDriver() error = %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	return d
+}
+
+// run runs an auto-commit query in a new session with config.
+func run(t *testing.T, d *Driver, config SessionConfig, query string) error {
+	ctx := context.Background()
+	s := d.NewSession(config)
+	defer s.Close(ctx)
+
+	res, err := s.Run(ctx, query, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = res.Consume(ctx)
+	return err
+}
+
+func TestDriver_routing(t *testing.T) {
+	c := newCluster(t, "reader1", "reader2", "writer")
+	c.table = func(string) packstream.Dictionary {
+		return c.rt(300, []string{"reader1", "reader2"}, []string{"writer"})
+	}
+	d := c.driver(t, "?region=eu")
+
+	for i := 0; i < 4; i++ {
+		if err := run(t, d, SessionConfig{AccessMode: AccessModeRead}, "read"); err != nil {
+			t.Fatalf("read error = %v", err)
+		}
+	}
+	if err := run(t, d, SessionConfig{}, "write"); err != nil {
+		t.Fatalf("write error = %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	want := map[string][]string{
+		"reader1": {"read", "read"},
+		"reader2": {"read", "read"},
+		"writer":  {"write"},
+	}
+	if !reflect.DeepEqual(c.queries, want) {
+		t.Errorf("queries = %v, want %v", c.queries, want)
+	}
+
+	if len(c.routes) != 1 {
+		t.Fatalf("ROUTE requests = %d, want 1", len(c.routes))
+	}
+	wantContext := packstream.Dictionary{"address": c.router.Addr(), "region": "eu"}
+	if !reflect.DeepEqual(c.routes[0].Routing, wantContext) {
+		t.Errorf("ROUTE routing = %v, want %v", c.routes[0].Routing, wantContext)
+	}
+}
+
+func TestDriver_routingRefresh(t *testing.T) {
+	c := newCluster(t, "a", "b")
+	c.table = func(string) packstream.Dictionary {
+		return c.rt(60, []string{"a"}, []string{"a"})
+	}
+	d := c.driver(t, "")
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	d.router.now = func() time.Time { return now }
+
+	if err := run(t, d, SessionConfig{}, "first"); err != nil {
+		t.Fatalf("run error = %v", err)
+	}
+
+	// The table is reused until it expires.
+	now = now.Add(59 * time.Second)
+	if err := run(t, d, SessionConfig{}, "second"); err != nil {
+		t.Fatalf("run error = %v", err)
+	}
+
+	c.mu.Lock()
+	c.table = func(string) packstream.Dictionary {
+		return c.rt(60, []string{"b"}, []string{"b"})
+	}
+	c.mu.Unlock()
+
+	now = now.Add(time.Second)
+	if err := run(t, d, SessionConfig{}, "third"); err != nil {
+		t.Fatalf("run error = %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	want := map[string][]string{"a": {"first", "second"}, "b": {"third"}}
+	if !reflect.DeepEqual(c.queries, want) {
+		t.Errorf("queries = %v, want %v", c.queries, want)
+	}
+	if len(c.routes) != 2 {
+		t.Errorf("ROUTE requests = %d, want 2", len(c.routes))
+	}
+}
+
+func TestDriver_routingNotALeader(t *testing.T) {
+	c := newCluster(t, "old", "new")
+	c.fail["old"] = packstream.Dictionary{"code": "Neo.ClientError.Cluster.NotALeader", "message": "not a leader"}
+	routes := 0
+	c.table = func(string) packstream.Dictionary {
+		routes++
+		if routes == 1 {
+			return c.rt(300, []string{"new"}, []string{"old"})
+		}
+		return c.rt(300, []string{"old"}, []string{"new"})
+	}
+	d := c.driver(t, "")
+	d.retry.sleep = func(context.Context, time.Duration) error { return nil }
+
+	ctx := context.Background()
+	s := d.NewSession(SessionConfig{})
+	defer s.Close(ctx)
+
+	_, err := s.ExecuteWrite(ctx, func(tx *Tx) (interface{}, error) {
+		res, err := tx.Run(ctx, "write", nil)
+		if err != nil {
+			return nil, err
+		}
+		return res.Consume(ctx)
+	})
+	if err != nil {
+		t.Fatalf("Session.ExecuteWrite() error = %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	want := map[string][]string{"old": {"write"}, "new": {"write"}}
+	if !reflect.DeepEqual(c.queries, want) {
+		t.Errorf("queries = %v, want %v", c.queries, want)
+	}
+	if routes != 2 {
+		t.Errorf("ROUTE requests = %d, want 2", routes)
+	}
+}
+
+func TestDriver_routingDatabases(t *testing.T) {
+	c := newCluster(t, "a", "b")
+	c.table = func(db string) packstream.Dictionary {
+		if db == "movies" {
+			return c.rt(300, []string{"b"}, []string{"b"})
+		}
+		return c.rt(300, []string{"a"}, []string{"a"})
+	}
+	d := c.driver(t, "")
+
+	for _, db := range []string{"", "movies", "", "movies"} {
+		if err := run(t, d, SessionConfig{Database: db}, "db:"+db); err != nil {
+			t.Fatalf("run error = %v", err)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	want := map[string][]string{"a": {"db:", "db:"}, "b": {"db:movies", "db:movies"}}
+	if !reflect.DeepEqual(c.queries, want) {
+		t.Errorf("queries = %v, want %v", c.queries, want)
+	}
+
+	var dbs []interface{}
+	for _, r := range c.routes {
+		dbs = append(dbs, r.Extra["db"])
+	}
+	if want := []interface{}{nil, "movies"}; !reflect.DeepEqual(dbs, want) {
+		t.Errorf("ROUTE databases = %v, want %v", dbs, want)
+	}
+}
+
+func TestDriver_routingServerDown(t *testing.T) {
+	c := newCluster(t, "a", "b")
+	c.table = func(string) packstream.Dictionary {
+		return c.rt(300, []string{"a", "b"}, []string{"a"})
+	}
+	d := c.driver(t, "")
+
+	c.servers["a"].Close()
+
+	// One of the first two reads is sent to a, fails and removes it from
+	// the table.
+	failed := 0
+	for i := 0; i < 2; i++ {
+		if run(t, d, SessionConfig{AccessMode: AccessModeRead}, "read") != nil {
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Errorf("failed reads = %d, want 1", failed)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := run(t, d, SessionConfig{AccessMode: AccessModeRead}, "read"); err != nil {
+			t.Errorf("read error = %v", err)
+		}
+	}
+
+	d.router.mu.Lock()
+	defer d.router.mu.Unlock()
+	if got, want := d.router.tables[""].readers, []string{c.servers["b"].Addr()}; !reflect.DeepEqual(got, want) {
+		t.Errorf("readers = %v, want %v", got, want)
+	}
+}
+
+// TestDriver_routingRefreshFullPool refreshes the routing table through a
+// router whose only connection is held by a session that then fails.
+func TestDriver_routingRefreshFullPool(t *testing.T) {
+	c := newCluster(t)
+	c.table = func(string) packstream.Dictionary {
+		addrs := packstream.List{c.router.Addr()}
+		return packstream.Dictionary{
+			"ttl": int64(60),
+			"servers": packstream.List{
+				packstream.Dictionary{"role": "ROUTE", "addresses": addrs},
+				packstream.Dictionary{"role": "WRITE", "addresses": addrs},
+			},
+		}
+	}
+
+	d, err := NewDriver("neo4j://"+c.router.Addr(), func(c *Config) { c.MaxConnectionPoolSize = 1 })
+	if err != nil {
+		t.Fatalf("NewDriver() error = %v", err)
+	}
+	defer d.Close()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	d.router.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	first := d.NewSession(SessionConfig{})
+	defer first.Close(ctx)
+
+	tx, err := first.BeginTransaction(ctx)
+	if err != nil {
+		t.Fatalf("Session.BeginTransaction() error = %v", err)
+	}
+
+	// The table expires, so the second session waits for the connection of
+	// the first to refresh it.
+	now = now.Add(time.Minute)
+	done := make(chan error, 1)
+	go func() { done <- run(t, d, SessionConfig{}, "second") }()
+	time.Sleep(50 * time.Millisecond)
+
+	c.mu.Lock()
+	c.fail["router"] = packstream.Dictionary{"code": "Neo.ClientError.Statement.SyntaxError", "message": "failed"}
+	c.mu.Unlock()
+	if _, err := tx.Run(ctx, "first", nil); err == nil {
+		t.Fatal("Tx.Run() expected error")
+	}
+	c.mu.Lock()
+	delete(c.fail, "router")
+	c.mu.Unlock()
+
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatalf("Tx.Rollback() error = %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("run error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("second session did not complete")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.routes) != 2 {
+		t.Errorf("ROUTE requests = %d, want 2", len(c.routes))
+	}
+}
@@ -0,0 +1,285 @@
+package graphdb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mattmeyers/graphdb/bolt"
+	"github.com/mattmeyers/graphdb/packstream"
+)
+
+var (
+	// ErrSessionClosed is returned when using a closed session.
+	ErrSessionClosed = errors.New("graphdb: session closed")
+
+	// ErrTxOpen is returned when running an auto-commit query or beginning
+	// a transaction while the session has an open transaction.
+	ErrTxOpen = errors.New("graphdb: session has an open transaction")
+
+	// ErrTxClosed is returned when using a committed or rolled back
+	// transaction.
+	ErrTxClosed = errors.New("graphdb: transaction closed")
+)
+
+// AccessMode tells the server whether a unit of work reads or writes.
+type AccessMode int
+
+const (
+	AccessModeWrite AccessMode = iota
+	AccessModeRead
+)
+
+// SessionConfig holds the settings of a Session.
+type SessionConfig struct {
+	// Database is the name of the database queries run against. The
+	// server's default database is used if empty.
+	Database string
+
+	// AccessMode is the access mode of the session's work.
+	AccessMode AccessMode
+
+	// ImpersonatedUser runs queries with the privileges of another user.
+	ImpersonatedUser string
+
+	// FetchSize overrides the driver's fetch size if non-zero.
+	FetchSize int
+
+	// Bookmarks are the bookmarks the session's first unit of work waits
+	// for, e.g. the LastBookmarks of another session.
+	Bookmarks []string
+
+	// BookmarkManager, if set, shares bookmarks with other sessions using
+	// the same manager.
+	BookmarkManager BookmarkManager
+}
+
+// TxConfig holds the settings of a transaction or auto-commit query.
+type TxConfig struct {
+	// Timeout makes the server terminate the transaction after the given
+	// duration. The server's default applies if zero.
+	Timeout time.Duration
+
+	// Metadata is attached to the transaction and shown by the server's
+	// transaction listing procedures.
+	Metadata map[string]interface{}
+}
+
+// WithTxTimeout sets the timeout of a transaction.
+func WithTxTimeout(d time.Duration) func(*TxConfig) {
+	return func(c *TxConfig) { c.Timeout = d }
+}
+
+// WithTxMetadata sets the metadata of a transaction.
+func WithTxMetadata(m map[string]interface{}) func(*TxConfig) {
+	return func(c *TxConfig) { c.Metadata = m }
+}
+
+// Session runs queries, either as auto-commit queries or in explicit
+// transactions, one at a time. A Session is not safe for concurrent use.
+type Session struct {
+	driver *Driver
+	config SessionConfig
+
+	conn   *pooledConn
+	result *Result
+	tx     *Tx
+	closed bool
+
+	lastBookmarks []string
+
+	// authErr is the last security error the auth token manager handled
+	// by providing a new token.
+	authErr error
+}
+
+// Run runs an auto-commit query, which the server commits once its result
+// has been consumed.
+func (s *Session) Run(ctx context.Context, query string, params map[string]interface{}, configurers ...func(*TxConfig)) (*Result, error) {
+	conn, bookmarks, err := s.prepare(ctx, s.config.AccessMode)
+	if err != nil {
+		return nil, err
+	}
+
+	extra := s.extra(s.config.AccessMode, bookmarks, configurers)
+	res, err := runQuery(ctx, conn.Conn, query, params, extra, int64(s.config.FetchSize))
+	if err != nil {
+		s.release(ctx, err)
+		return nil, err
+	}
+	res.onDone = func(ctx context.Context, err error) {
+		if err == nil {
+			res.err = s.updateBookmark(ctx, bookmarks, res.summary["bookmark"])
+		}
+		s.release(ctx, err)
+	}
+	s.result = res
+
+	return res, nil
+}
+
+// BeginTransaction begins an explicit transaction. The session cannot be
+// used for other work until the transaction is committed or rolled back.
+func (s *Session) BeginTransaction(ctx context.Context, configurers ...func(*TxConfig)) (*Tx, error) {
+	return s.beginTransaction(ctx, s.config.AccessMode, configurers)
+}
+
+func (s *Session) beginTransaction(ctx context.Context, mode AccessMode, configurers []func(*TxConfig)) (*Tx, error) {
+	conn, bookmarks, err := s.prepare(ctx, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Begin(ctx, s.extra(mode, bookmarks, configurers)); err != nil {
+		s.release(ctx, err)
+		return nil, err
+	}
+	s.tx = &Tx{session: s, conn: conn.Conn, bookmarks: bookmarks}
+
+	return s.tx, nil
+}
+
+// Close rolls back an open transaction, discards the records of an open
+// result and releases the session's connection.
+func (s *Session) Close(ctx context.Context) error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	var err error
+	if s.tx != nil {
+		err = s.tx.Rollback(ctx)
+	} else if s.result != nil {
+		_, err = s.result.Consume(ctx)
+	}
+
+	s.release(ctx, nil)
+
+	return err
+}
+
+// prepare acquires a connection for a new auto-commit query or transaction
+// in mode and returns the bookmarks to start it with. Remaining records of
+// the previous result are buffered so it can still be read.
+func (s *Session) prepare(ctx context.Context, mode AccessMode) (*pooledConn, []string, error) {
+	if s.closed {
+		return nil, nil, ErrSessionClosed
+	}
+	if s.tx != nil {
+		return nil, nil, ErrTxOpen
+	}
+
+	if s.result != nil {
+		// A failure of the previous query belongs to its result.
+		s.result.buffer(ctx)
+		s.result = nil
+	}
+
+	bookmarks, err := s.bookmarks(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	addr := s.driver.addr
+	if s.driver.router != nil {
+		addr, err = s.driver.router.server(ctx, s.config.Database, mode, s.config.ImpersonatedUser, bookmarks)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	conn, err := s.driver.pool.acquire(ctx, addr)
+	if err != nil {
+		if s.driver.router != nil {
+			s.driver.router.handleError(s.config.Database, addr, err)
+		}
+		var ae *authError
+		if errors.As(err, &ae) {
+			s.handleSecurityError(ctx, ae.token, err)
+		}
+		return nil, nil, err
+	}
+	s.conn = conn
+
+	return conn, bookmarks, nil
+}
+
+// release returns the session's connection to the pool once its work is
+// done. A failed connection is reset first so that it can be reused. The
+// error that ended the work, if any, is then used to update the routing
+// table, after the connection is back in the pool for a session that might
+// be refreshing the table.
+func (s *Session) release(ctx context.Context, err error) {
+	if s.conn == nil {
+		return
+	}
+	// The connection may be handed to another session once released.
+	addr, auth := s.conn.addr, s.conn.auth
+
+	if s.conn.State() == bolt.Failed {
+		s.conn.Reset(ctx)
+	}
+	s.driver.pool.release(s.conn)
+	s.conn = nil
+
+	if err != nil && s.driver.router != nil {
+		s.driver.router.handleError(s.config.Database, addr, err)
+	}
+
+	s.handleSecurityError(ctx, auth, err)
+}
+
+// handleSecurityError passes err to the auth manager if it is a security
+// error of work authenticated with token. Errors the manager handled, e.g.
+// by renewing an expired token, let managed transactions retry.
+func (s *Session) handleSecurityError(ctx context.Context, token AuthToken, err error) {
+	var ne *bolt.Neo4jError
+	if !errors.As(err, &ne) || ne.Category() != "Security" {
+		return
+	}
+
+	if s.driver.auth.HandleSecurityError(ctx, token, err) {
+		s.authErr = ne
+	}
+}
+
+// extra returns the extra dictionary of a RUN or BEGIN starting a unit of
+// work with the given access mode, bookmarks and configuration.
+func (s *Session) extra(mode AccessMode, bookmarks []string, configurers []func(*TxConfig)) packstream.Dictionary {
+	var config TxConfig
+	for _, c := range configurers {
+		c(&config)
+	}
+
+	extra := packstream.Dictionary{}
+	if s.config.Database != "" {
+		extra["db"] = s.config.Database
+	}
+	if mode == AccessModeRead {
+		extra["mode"] = "r"
+	}
+	if s.config.ImpersonatedUser != "" {
+		extra["imp_user"] = s.config.ImpersonatedUser
+	}
+	if len(bookmarks) > 0 {
+		extra["bookmarks"] = stringList(bookmarks)
+	}
+	if config.Timeout > 0 {
+		extra["tx_timeout"] = config.Timeout.Milliseconds()
+	}
+	if len(config.Metadata) > 0 {
+		extra["tx_metadata"] = packstream.Dictionary(config.Metadata)
+	}
+
+	return extra
+}
+
+func stringList(l []string) packstream.List {
+	out := make(packstream.List, len(l))
+	for i, s := range l {
+		out[i] = s
+	}
+
+	return out
+}
@@ -0,0 +1,349 @@
+package graphdb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mattmeyers/graphdb/bolt"
+	"github.com/mattmeyers/graphdb/packstream"
+)
+
+// requestNames returns the type names of reqs, e.g. "Run".
+func requestNames(reqs []bolt.Message) []string {
+	names := make([]string, len(reqs))
+	for i, req := range reqs {
+		names[i] = reflect.TypeOf(req).Name()
+	}
+	return names
+}
+
+func TestSession_extra(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      SessionConfig
+		configurers []func(*TxConfig)
+		want        packstream.Dictionary
+	}{
+		{
+			name:   "defaults",
+			config: SessionConfig{},
+			want:   packstream.Dictionary{},
+		},
+		{
+			name: "session config",
+			config: SessionConfig{
+				Database:         "movies",
+				AccessMode:       AccessModeRead,
+				ImpersonatedUser: "alice",
+			},
+			want: packstream.Dictionary{
+				"db":       "movies",
+				"mode":     "r",
+				"imp_user": "alice",
+			},
+		},
+		{
+			name:   "transaction config",
+			config: SessionConfig{},
+			configurers: []func(*TxConfig){
+				WithTxTimeout(1500 * time.Millisecond),
+				WithTxMetadata(map[string]interface{}{"app": "test"}),
+			},
+			want: packstream.Dictionary{
+				"tx_timeout":  int64(1500),
+				"tx_metadata": packstream.Dictionary{"app": "test"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			rec := &recorder{next: (&fakeQuery{}).handle}
+			s := newTestDriver(t, rec.handle).NewSession(tt.config)
+			defer s.Close(ctx)
+
+			res, err := s.Run(ctx, "RETURN 1", nil, tt.configurers...)
+			if err != nil {
+				t.Fatalf("Session.Run() error = %v", err)
+			}
+			if _, err := res.Consume(ctx); err != nil {
+				t.Fatalf("Result.Consume() error = %v", err)
+			}
+
+			tx, err := s.BeginTransaction(ctx, tt.configurers...)
+			if err != nil {
+				t.Fatalf("Session.BeginTransaction() error = %v", err)
+			}
+			if err := tx.Rollback(ctx); err != nil {
+				t.Fatalf("Tx.Rollback() error = %v", err)
+			}
+
+			reqs := rec.requests()
+			if got := reqs[0].(bolt.Run).Extra; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RUN extra = %v, want %v", got, tt.want)
+			}
+			if got := reqs[2].(bolt.Begin).Extra; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BEGIN extra = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSession_Run(t *testing.T) {
+	ctx := context.Background()
+	q := &fakeQuery{keys: packstream.List{"n"}, records: records(3)}
+	s := newTestDriver(t, q.handle).NewSession(SessionConfig{FetchSize: 2})
+	defer s.Close(ctx)
+
+	first, err := s.Run(ctx, "UNWIND range(0, 2) AS n RETURN n", nil)
+	if err != nil {
+		t.Fatalf("Session.Run() error = %v", err)
+	}
+	if !first.Next(ctx) {
+		t.Fatalf("Result.Next() = false, err = %v", first.Err())
+	}
+
+	// The remaining records of the first result are buffered.
+	second, err := s.Run(ctx, "UNWIND range(0, 2) AS n RETURN n", nil)
+	if err != nil {
+		t.Fatalf("Session.Run() error = %v", err)
+	}
+
+	for _, res := range []*Result{second, first} {
+		var got []packstream.List
+		for res.Next(ctx) {
+			got = append(got, res.Record().Values)
+		}
+		if err := res.Err(); err != nil {
+			t.Fatalf("Result.Err() = %v", err)
+		}
+		if res == first {
+			got = append([]packstream.List{{int64(0)}}, got...)
+		}
+		if !reflect.DeepEqual(got, q.records) {
+			t.Errorf("Result.Record() = %v, want %v", got, q.records)
+		}
+	}
+}
+
+func TestSession_Run_afterFailure(t *testing.T) {
+	ctx := context.Background()
+	rec := &recorder{next: func(req bolt.Message) []bolt.Message {
+		if run, ok := req.(bolt.Run); ok && run.Query == "fail" {
+			return []bolt.Message{bolt.Failure{Metadata: packstream.Dictionary{
+				"code":    "Neo.ClientError.Statement.SyntaxError",
+				"message": "Invalid input",
+			}}}
+		}
+		return nil
+	}}
+	s := newTestDriver(t, rec.handle).NewSession(SessionConfig{})
+	defer s.Close(ctx)
+
+	var ne *bolt.Neo4jError
+	if _, err := s.Run(ctx, "fail", nil); !errors.As(err, &ne) {
+		t.Fatalf("Session.Run() error = %v, want *bolt.Neo4jError", err)
+	}
+
+	if _, err := s.Run(ctx, "RETURN 1", nil); err != nil {
+		t.Fatalf("Session.Run() after failure error = %v", err)
+	}
+
+	want := []string{"Run", "Reset", "Run"}
+	if got := requestNames(rec.requests()); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %v, want %v", got, want)
+	}
+}
+
+func TestTx(t *testing.T) {
+	tests := []struct {
+		name        string
+		finish      func(tx *Tx, ctx context.Context) error
+		wantRecords int
+		want        []string
+	}{
+		{
+			name:        "commit buffers records",
+			finish:      (*Tx).Commit,
+			wantRecords: 3,
+			want:        []string{"Begin", "Run", "Pull", "Commit"},
+		},
+		{
+			name:        "rollback discards records",
+			finish:      (*Tx).Rollback,
+			wantRecords: 0,
+			want:        []string{"Begin", "Run", "Discard", "Rollback"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			q := &fakeQuery{keys: packstream.List{"n"}, records: records(3)}
+			rec := &recorder{next: q.handle}
+			s := newTestDriver(t, rec.handle).NewSession(SessionConfig{})
+			defer s.Close(ctx)
+
+			tx, err := s.BeginTransaction(ctx)
+			if err != nil {
+				t.Fatalf("Session.BeginTransaction() error = %v", err)
+			}
+			defer tx.Rollback(ctx)
+
+			res, err := tx.Run(ctx, "UNWIND range(0, 2) AS n RETURN n", map[string]interface{}{"x": 1})
+			if err != nil {
+				t.Fatalf("Tx.Run() error = %v", err)
+			}
+
+			if _, err := s.Run(ctx, "RETURN 1", nil); err != ErrTxOpen {
+				t.Errorf("Session.Run() error = %v, want %v", err, ErrTxOpen)
+			}
+
+			if err := tt.finish(tx, ctx); err != nil {
+				t.Fatalf("finish error = %v", err)
+			}
+
+			n := 0
+			for res.Next(ctx) {
+				n++
+			}
+			if n != tt.wantRecords {
+				t.Errorf("Result.Next() returned %d records, want %d", n, tt.wantRecords)
+			}
+
+			if _, err := tx.Run(ctx, "RETURN 1", nil); err != ErrTxClosed {
+				t.Errorf("Tx.Run() error = %v, want %v", err, ErrTxClosed)
+			}
+			if err := tx.Commit(ctx); err != ErrTxClosed {
+				t.Errorf("Tx.Commit() error = %v, want %v", err, ErrTxClosed)
+			}
+
+			if got := requestNames(rec.requests()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("requests = %v, want %v", got, tt.want)
+			}
+			if run := rec.requests()[1].(bolt.Run); !reflect.DeepEqual(run.Parameters, packstream.Dictionary{"x": int64(1)}) {
+				t.Errorf("RUN parameters = %v, want %v", run.Parameters, packstream.Dictionary{"x": int64(1)})
+			}
+		})
+	}
+}
+
+func TestSession_Close(t *testing.T) {
+	ctx := context.Background()
+	rec := &recorder{next: (&fakeQuery{}).handle}
+	s := newTestDriver(t, rec.handle).NewSession(SessionConfig{})
+
+	if _, err := s.BeginTransaction(ctx); err != nil {
+		t.Fatalf("Session.BeginTransaction() error = %v", err)
+	}
+	if err := s.Close(ctx); err != nil {
+		t.Fatalf("Session.Close() error = %v", err)
+	}
+
+	if _, err := s.Run(ctx, "RETURN 1", nil); err != ErrSessionClosed {
+		t.Errorf("Session.Run() error = %v, want %v", err, ErrSessionClosed)
+	}
+
+	want := []string{"Begin", "Rollback"}
+	if got := requestNames(rec.requests()); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %v, want %v", got, want)
+	}
+}
+
+func TestSession_Run_cancel(t *testing.T) {
+	q := &fakeQuery{keys: packstream.List{"n"}, records: records(3)}
+	unblock := make(chan struct{})
+	d := newTestDriver(t, func(req bolt.Message) []bolt.Message {
+		if _, ok := req.(bolt.Pull); ok {
+			<-unblock
+		}
+		return q.handle(req)
+	})
+	defer close(unblock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := d.NewSession(SessionConfig{})
+	res, err := s.Run(ctx, "RETURN 1", nil)
+	if err != nil {
+		t.Fatalf("Session.Run() error = %v", err)
+	}
+
+	start := time.Now()
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if res.Next(ctx) {
+		t.Fatal("Result.Next() = true, want false")
+	}
+	if !errors.Is(res.Err(), context.Canceled) {
+		t.Errorf("Result.Err() = %v, want %v", res.Err(), context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Result.Next() took %v", elapsed)
+	}
+	s.Close(ctx)
+
+	// The interrupted connection is kept and reset once it is reused.
+	want := PoolMetrics{Idle: 1, Created: 1}
+	if got := d.PoolMetrics()[d.addr]; got != want {
+		t.Errorf("PoolMetrics() = %+v, want %+v", got, want)
+	}
+
+	unblock <- struct{}{}
+
+	s = d.NewSession(SessionConfig{})
+	defer s.Close(context.Background())
+
+	res, err = s.Run(context.Background(), "RETURN 1", nil)
+	if err != nil {
+		t.Fatalf("Session.Run() after cancel error = %v", err)
+	}
+	go func() { unblock <- struct{}{} }()
+
+	var n int
+	for res.Next(context.Background()) {
+		n++
+	}
+	if err := res.Err(); err != nil {
+		t.Fatalf("Result.Err() = %v", err)
+	}
+	if n != 3 {
+		t.Errorf("records = %d, want 3", n)
+	}
+
+	want = PoolMetrics{Idle: 1, Created: 1}
+	if got := d.PoolMetrics()[d.addr]; got != want {
+		t.Errorf("PoolMetrics() = %+v, want %+v", got, want)
+	}
+}
+
+func TestTx_Commit_cancel(t *testing.T) {
+	unblock := make(chan struct{})
+	d := newTestDriver(t, func(req bolt.Message) []bolt.Message {
+		if _, ok := req.(bolt.Commit); ok {
+			<-unblock
+		}
+		return nil
+	})
+	defer close(unblock)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	s := d.NewSession(SessionConfig{})
+	defer s.Close(context.Background())
+
+	tx, err := s.BeginTransaction(ctx)
+	if err != nil {
+		t.Fatalf("Session.BeginTransaction() error = %v", err)
+	}
+
+	err = tx.Commit(ctx)
+
+	var uce *UnknownCommitError
+	if !errors.As(err, &uce) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Tx.Commit() error = %v, want an UnknownCommitError caused by the deadline", err)
+	}
+}
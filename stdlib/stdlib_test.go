@@ -0,0 +1,328 @@
+package stdlib
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattmeyers/graphdb"
+	"github.com/mattmeyers/graphdb/bolt"
+	"github.com/mattmeyers/graphdb/bolt/bolttest"
+	"github.com/mattmeyers/graphdb/packstream"
+)
+
+var (
+	alice = packstream.Node{ID: 1, Labels: packstream.List{"Person"}, Properties: packstream.Dictionary{"name": "Alice"}}
+	bob   = packstream.Node{ID: 2, Labels: packstream.List{"Person"}, Properties: packstream.Dictionary{"name": "Bob"}}
+)
+
+// server answers the queries used by the tests and records the requests it
+// receives.
+type server struct {
+	mu    sync.Mutex
+	reqs  []bolt.Message
+	query string
+}
+
+func (s *server) handle(req bolt.Message) []bolt.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reqs = append(s.reqs, req)
+
+	switch req := req.(type) {
+	case bolt.Run:
+		s.query = req.Query
+		switch req.Query {
+		case "MATCH (n) RETURN n, n.name":
+			return []bolt.Message{bolt.Success{Metadata: packstream.Dictionary{"fields": packstream.List{"n", "n.name"}}}}
+		case "FAIL":
+			return []bolt.Message{bolt.Failure{Metadata: packstream.Dictionary{
+				"code":    "Neo.ClientError.Statement.SyntaxError",
+				"message": "Invalid input",
+			}}}
+		}
+		return []bolt.Message{bolt.Success{Metadata: packstream.Dictionary{"fields": packstream.List{}}}}
+	case bolt.Pull, bolt.Discard:
+		if s.query == "MATCH (n) RETURN n, n.name" {
+			if _, ok := req.(bolt.Discard); ok {
+				return nil
+			}
+			return []bolt.Message{
+				bolt.Record{Data: packstream.List{alice, "Alice"}},
+				bolt.Record{Data: packstream.List{bob, "Bob"}},
+				bolt.Success{},
+			}
+		}
+		return []bolt.Message{bolt.Success{Metadata: packstream.Dictionary{
+			"stats": packstream.Dictionary{"nodes-created": int64(2), "properties-set": int64(3)},
+		}}}
+	}
+
+	return nil
+}
+
+// requests returns the requests received other than those initializing
+// connections.
+func (s *server) requests() []bolt.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var reqs []bolt.Message
+	for _, req := range s.reqs {
+		switch req.(type) {
+		case bolt.Hello, bolt.Logon:
+			continue
+		}
+		reqs = append(reqs, req)
+	}
+
+	return reqs
+}
+
+func requestNames(reqs []bolt.Message) []string {
+	names := make([]string, len(reqs))
+	for i, req := range reqs {
+		names[i] = reflect.TypeOf(req).Name()
+	}
+	return names
+}
+
+// open starts a fake server and returns a database connected to it.
+func open(t *testing.T) (*sql.DB, *server) {
+	t.Helper()
+
+	srv := &server{}
+	s := bolttest.NewServer(srv.handle)
+	t.Cleanup(s.Close)
+
+	db, err := sql.Open("graphdb", "bolt://neo4j:secret@"+s.Addr())
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db, srv
+}
+
+func TestDB_Query(t *testing.T) {
+	ctx := context.Background()
+	db, srv := open(t)
+
+	rows, err := db.QueryContext(ctx, "MATCH (n) RETURN n, n.name")
+	if err != nil {
+		t.Fatalf("DB.QueryContext() error = %v", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatalf("Rows.Columns() error = %v", err)
+	}
+	if want := []string{"n", "n.name"}; !reflect.DeepEqual(columns, want) {
+		t.Errorf("Rows.Columns() = %v, want %v", columns, want)
+	}
+
+	var nodes []packstream.Node
+	var names []string
+	for rows.Next() {
+		var n packstream.Node
+		var name string
+		if err := rows.Scan(&n, &name); err != nil {
+			t.Fatalf("Rows.Scan() error = %v", err)
+		}
+		nodes = append(nodes, n)
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("Rows.Err() error = %v", err)
+	}
+
+	if want := []packstream.Node{alice, bob}; !reflect.DeepEqual(nodes, want) {
+		t.Errorf("nodes = %v, want %v", nodes, want)
+	}
+	if want := []string{"Alice", "Bob"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	var auth packstream.Dictionary
+	for _, req := range srv.reqs {
+		switch req := req.(type) {
+		case bolt.Hello:
+			auth = req.Extra
+		case bolt.Logon:
+			auth = req.Auth
+		}
+	}
+	if auth["principal"] != "neo4j" || auth["credentials"] != "secret" {
+		t.Errorf("auth = %v, want the credentials of the DSN", auth)
+	}
+}
+
+func TestDB_Query_error(t *testing.T) {
+	db, _ := open(t)
+
+	_, err := db.QueryContext(context.Background(), "FAIL")
+
+	var ne *graphdb.Neo4jError
+	if !errors.As(err, &ne) || ne.Code != "Neo.ClientError.Statement.SyntaxError" {
+		t.Errorf("DB.QueryContext() error = %v, want a syntax error", err)
+	}
+}
+
+func TestDB_Exec(t *testing.T) {
+	ctx := context.Background()
+	db, srv := open(t)
+
+	res, err := db.ExecContext(ctx, "CREATE (:Person {name: $name, age: $2})", sql.Named("name", "Alice"), 42)
+	if err != nil {
+		t.Fatalf("DB.ExecContext() error = %v", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		t.Fatalf("Result.RowsAffected() error = %v", err)
+	}
+	if n != 5 {
+		t.Errorf("Result.RowsAffected() = %d, want 5", n)
+	}
+
+	reqs := srv.requests()
+	if got, want := requestNames(reqs), []string{"Run", "Discard"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("requests = %v, want %v", got, want)
+	}
+	want := packstream.Dictionary{"name": "Alice", "2": int64(42)}
+	if got := reqs[0].(bolt.Run).Parameters; !reflect.DeepEqual(got, want) {
+		t.Errorf("RUN parameters = %v, want %v", got, want)
+	}
+}
+
+func TestDB_BeginTx(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     *sql.TxOptions
+		commit   bool
+		wantReqs []string
+		wantMode interface{}
+	}{
+		{
+			name:     "commit",
+			opts:     nil,
+			commit:   true,
+			wantReqs: []string{"Begin", "Run", "Discard", "Commit"},
+			wantMode: nil,
+		},
+		{
+			name:     "rollback",
+			opts:     nil,
+			commit:   false,
+			wantReqs: []string{"Begin", "Run", "Discard", "Rollback"},
+			wantMode: nil,
+		},
+		{
+			name:     "read only",
+			opts:     &sql.TxOptions{ReadOnly: true},
+			commit:   true,
+			wantReqs: []string{"Begin", "Run", "Discard", "Commit"},
+			wantMode: "r",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db, srv := open(t)
+
+			tx, err := db.BeginTx(ctx, tt.opts)
+			if err != nil {
+				t.Fatalf("DB.BeginTx() error = %v", err)
+			}
+			if _, err := tx.ExecContext(ctx, "CREATE (n)"); err != nil {
+				t.Fatalf("Tx.ExecContext() error = %v", err)
+			}
+			if tt.commit {
+				err = tx.Commit()
+			} else {
+				err = tx.Rollback()
+			}
+			if err != nil {
+				t.Fatalf("ending the transaction: error = %v", err)
+			}
+
+			reqs := srv.requests()
+			if got := requestNames(reqs); !reflect.DeepEqual(got, tt.wantReqs) {
+				t.Fatalf("requests = %v, want %v", got, tt.wantReqs)
+			}
+			if got := reqs[0].(bolt.Begin).Extra["mode"]; got != tt.wantMode {
+				t.Errorf("BEGIN mode = %v, want %v", got, tt.wantMode)
+			}
+		})
+	}
+}
+
+func TestDB_BeginTx_isolation(t *testing.T) {
+	db, _ := open(t)
+
+	_, err := db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err == nil {
+		t.Error("DB.BeginTx() expected error for isolation level")
+	}
+}
+
+type celsius float64
+
+func (c celsius) Value() (driver.Value, error) {
+	return float64(c), nil
+}
+
+func TestValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name: "unchanged",
+			v:    packstream.List{int64(1), "a"},
+			want: packstream.List{int64(1), "a"},
+		},
+		{
+			name: "valuer",
+			v:    celsius(21.5),
+			want: 21.5,
+		},
+		{
+			name: "nil valuer",
+			v:    (*sql.NullString)(nil),
+			want: nil,
+		},
+		{
+			name: "null valuer",
+			v:    sql.NullString{},
+			want: nil,
+		},
+		{
+			name: "time",
+			v:    time.Date(2024, 5, 1, 12, 0, 0, 5, time.FixedZone("", 7_200)),
+			want: packstream.DateTime{Seconds: 1_714_564_800, Nanoseconds: 5, TZOffsetSeconds: 7_200},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := value(tt.v)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("value() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("value() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package graphdb
+
+import (
+	"time"
+
+	"github.com/mattmeyers/graphdb/packstream"
+)
+
+// QueryType describes whether a query read or wrote data.
+type QueryType string
+
+const (
+	QueryTypeRead        QueryType = "r"
+	QueryTypeReadWrite   QueryType = "rw"
+	QueryTypeWrite       QueryType = "w"
+	QueryTypeSchemaWrite QueryType = "s"
+)
+
+// ResultSummary describes a completed query.
+type ResultSummary struct {
+	QueryType QueryType
+
+	// Database is the database the query ran against.
+	Database string
+
+	Counters Counters
+
+	// Plan is the plan of an EXPLAIN query, and Profile the plan of a
+	// PROFILE query with the statistics of its execution.
+	Plan    *Plan
+	Profile *ProfiledPlan
+
+	Notifications []Notification
+
+	// ResultAvailableAfter is the time the server took until the first
+	// record was available, and ResultConsumedAfter the time it took until
+	// all records were consumed.
+	ResultAvailableAfter time.Duration
+	ResultConsumedAfter  time.Duration
+
+	// Metadata holds the metadata of the SUCCESS messages of RUN and of the
+	// final PULL or DISCARD the summary was parsed from.
+	Metadata packstream.Dictionary
+}
+
+// Counters counts the updates made by a query.
+type Counters struct {
+	NodesCreated         int
+	NodesDeleted         int
+	RelationshipsCreated int
+	RelationshipsDeleted int
+	PropertiesSet        int
+	LabelsAdded          int
+	LabelsRemoved        int
+	IndexesAdded         int
+	IndexesRemoved       int
+	ConstraintsAdded     int
+	ConstraintsRemoved   int
+	SystemUpdates        int
+
+	// ContainsUpdates reports whether the query updated the graph or the
+	// schema, and ContainsSystemUpdates whether it updated the system
+	// database.
+	ContainsUpdates       bool
+	ContainsSystemUpdates bool
+}
+
+// Plan is an operator of a query plan, the root of which describes the
+// whole query.
+type Plan struct {
+	Operator    string
+	Arguments   packstream.Dictionary
+	Identifiers []string
+	Children    []Plan
+}
+
+// ProfiledPlan is an operator of an executed query plan with the statistics
+// of its execution.
+type ProfiledPlan struct {
+	Operator    string
+	Arguments   packstream.Dictionary
+	Identifiers []string
+
+	DbHits            int64
+	Records           int64
+	PageCacheHits     int64
+	PageCacheMisses   int64
+	PageCacheHitRatio float64
+	Time              time.Duration
+
+	Children []ProfiledPlan
+}
+
+// NotificationSeverity is the severity of a notification.
+type NotificationSeverity string
+
+const (
+	SeverityWarning     NotificationSeverity = "WARNING"
+	SeverityInformation NotificationSeverity = "INFORMATION"
+)
+
+// NotificationCategory groups notifications by the kind of problem they
+// report.
+type NotificationCategory string
+
+const (
+	CategoryHint         NotificationCategory = "HINT"
+	CategoryUnrecognized NotificationCategory = "UNRECOGNIZED"
+	CategoryUnsupported  NotificationCategory = "UNSUPPORTED"
+	CategoryPerformance  NotificationCategory = "PERFORMANCE"
+	CategoryDeprecation  NotificationCategory = "DEPRECATION"
+	CategorySecurity     NotificationCategory = "SECURITY"
+	CategoryTopology     NotificationCategory = "TOPOLOGY"
+	CategoryGeneric      NotificationCategory = "GENERIC"
+	CategorySchema       NotificationCategory = "SCHEMA"
+)
+
+// Notification is a message of the server about a query, e.g. a warning
+// about a deprecated feature.
+type Notification struct {
+	Code        string
+	Title       string
+	Description string
+	Severity    NotificationSeverity
+	Category    NotificationCategory
+
+	// Position is the position in the query the notification refers to,
+	// if any.
+	Position *InputPosition
+}
+
+// InputPosition is a position in a query. Lines and columns start at 1 and
+// the offset at 0.
+type InputPosition struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// parseSummary parses the summary of a query from the metadata of the
+// SUCCESS to its RUN and that of the SUCCESS ending the result.
+func parseSummary(run, end packstream.Dictionary) *ResultSummary {
+	meta := make(packstream.Dictionary, len(run)+len(end))
+	for k, v := range run {
+		meta[k] = v
+	}
+	for k, v := range end {
+		meta[k] = v
+	}
+
+	s := &ResultSummary{Metadata: meta}
+
+	typ, _ := meta["type"].(string)
+	s.QueryType = QueryType(typ)
+	s.Database, _ = meta["db"].(string)
+
+	stats, _ := meta["stats"].(packstream.Dictionary)
+	s.Counters = parseCounters(stats)
+
+	if plan, ok := meta["plan"].(packstream.Dictionary); ok {
+		p := parsePlan(plan)
+		s.Plan = &p
+	}
+	if profile, ok := meta["profile"].(packstream.Dictionary); ok {
+		p := parseProfiledPlan(profile)
+		s.Profile = &p
+	}
+
+	notifications, _ := meta["notifications"].(packstream.List)
+	for _, n := range notifications {
+		if n, ok := n.(packstream.Dictionary); ok {
+			s.Notifications = append(s.Notifications, parseNotification(n))
+		}
+	}
+
+	if ms, ok := meta["t_first"].(int64); ok {
+		s.ResultAvailableAfter = time.Duration(ms) * time.Millisecond
+	}
+	if ms, ok := meta["t_last"].(int64); ok {
+		s.ResultConsumedAfter = time.Duration(ms) * time.Millisecond
+	}
+
+	return s
+}
+
+// parseCounters parses the stats of a summary, which only holds the
+// counters that are not zero.
+func parseCounters(stats packstream.Dictionary) Counters {
+	count := func(key string) int {
+		n, _ := stats[key].(int64)
+		return int(n)
+	}
+
+	c := Counters{
+		NodesCreated:         count("nodes-created"),
+		NodesDeleted:         count("nodes-deleted"),
+		RelationshipsCreated: count("relationships-created"),
+		RelationshipsDeleted: count("relationships-deleted"),
+		PropertiesSet:        count("properties-set"),
+		LabelsAdded:          count("labels-added"),
+		LabelsRemoved:        count("labels-removed"),
+		IndexesAdded:         count("indexes-added"),
+		IndexesRemoved:       count("indexes-removed"),
+		ConstraintsAdded:     count("constraints-added"),
+		ConstraintsRemoved:   count("constraints-removed"),
+		SystemUpdates:        count("system-updates"),
+	}
+
+	// Older servers do not send the flags, which then follow from the
+	// counters.
+	var ok bool
+	if c.ContainsUpdates, ok = stats["contains-updates"].(bool); !ok {
+		c.ContainsUpdates = c.NodesCreated+c.NodesDeleted+
+			c.RelationshipsCreated+c.RelationshipsDeleted+
+			c.PropertiesSet+c.LabelsAdded+c.LabelsRemoved+
+			c.IndexesAdded+c.IndexesRemoved+
+			c.ConstraintsAdded+c.ConstraintsRemoved > 0
+	}
+	if c.ContainsSystemUpdates, ok = stats["contains-system-updates"].(bool); !ok {
+		c.ContainsSystemUpdates = c.SystemUpdates > 0
+	}
+
+	return c
+}
+
+func parsePlan(plan packstream.Dictionary) Plan {
+	p := Plan{}
+	p.Operator, p.Arguments, p.Identifiers = parseOperator(plan)
+
+	children, _ := plan["children"].(packstream.List)
+	for _, child := range children {
+		if child, ok := child.(packstream.Dictionary); ok {
+			p.Children = append(p.Children, parsePlan(child))
+		}
+	}
+
+	return p
+}
+
+func parseProfiledPlan(profile packstream.Dictionary) ProfiledPlan {
+	p := ProfiledPlan{}
+	p.Operator, p.Arguments, p.Identifiers = parseOperator(profile)
+
+	p.DbHits, _ = profile["dbHits"].(int64)
+	p.Records, _ = profile["rows"].(int64)
+	p.PageCacheHits, _ = profile["pageCacheHits"].(int64)
+	p.PageCacheMisses, _ = profile["pageCacheMisses"].(int64)
+	p.PageCacheHitRatio, _ = profile["pageCacheHitRatio"].(float64)
+	if ns, ok := profile["time"].(int64); ok {
+		p.Time = time.Duration(ns)
+	}
+
+	children, _ := profile["children"].(packstream.List)
+	for _, child := range children {
+		if child, ok := child.(packstream.Dictionary); ok {
+			p.Children = append(p.Children, parseProfiledPlan(child))
+		}
+	}
+
+	return p
+}
+
+// parseOperator parses the fields shared by plans and profiled plans.
+func parseOperator(plan packstream.Dictionary) (operator string, args packstream.Dictionary, identifiers []string) {
+	operator, _ = plan["operatorType"].(string)
+	args, _ = plan["args"].(packstream.Dictionary)
+
+	ids, _ := plan["identifiers"].(packstream.List)
+	for _, id := range ids {
+		if id, ok := id.(string); ok {
+			identifiers = append(identifiers, id)
+		}
+	}
+
+	return operator, args, identifiers
+}
+
+func parseNotification(n packstream.Dictionary) Notification {
+	var notification Notification
+	notification.Code, _ = n["code"].(string)
+	notification.Title, _ = n["title"].(string)
+	notification.Description, _ = n["description"].(string)
+
+	severity, _ := n["severity"].(string)
+	notification.Severity = NotificationSeverity(severity)
+	category, _ := n["category"].(string)
+	notification.Category = NotificationCategory(category)
+
+	if pos, ok := n["position"].(packstream.Dictionary); ok {
+		offset, _ := pos["offset"].(int64)
+		line, _ := pos["line"].(int64)
+		column, _ := pos["column"].(int64)
+		notification.Position = &InputPosition{Offset: int(offset), Line: int(line), Column: int(column)}
+	}
+
+	return notification
+}
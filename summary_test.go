@@ -0,0 +1,196 @@
+package graphdb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mattmeyers/graphdb/packstream"
+)
+
+func TestParseSummary(t *testing.T) {
+	run := packstream.Dictionary{"fields": packstream.List{"n"}, "t_first": int64(12)}
+
+	tests := []struct {
+		name string
+		end  packstream.Dictionary
+		want ResultSummary
+	}{
+		{
+			name: "read",
+			end:  packstream.Dictionary{"type": "r", "db": "neo4j", "t_last": int64(3)},
+			want: ResultSummary{
+				QueryType:            QueryTypeRead,
+				Database:             "neo4j",
+				ResultAvailableAfter: 12 * time.Millisecond,
+				ResultConsumedAfter:  3 * time.Millisecond,
+			},
+		},
+		{
+			name: "counters",
+			end: packstream.Dictionary{
+				"type": "w",
+				"stats": packstream.Dictionary{
+					"nodes-created":         int64(2),
+					"relationships-deleted": int64(1),
+					"properties-set":        int64(4),
+					"labels-added":          int64(2),
+					"indexes-added":         int64(1),
+					"constraints-removed":   int64(1),
+				},
+			},
+			want: ResultSummary{
+				QueryType: QueryTypeWrite,
+				Counters: Counters{
+					NodesCreated:         2,
+					RelationshipsDeleted: 1,
+					PropertiesSet:        4,
+					LabelsAdded:          2,
+					IndexesAdded:         1,
+					ConstraintsRemoved:   1,
+					ContainsUpdates:      true,
+				},
+				ResultAvailableAfter: 12 * time.Millisecond,
+			},
+		},
+		{
+			name: "system updates",
+			end: packstream.Dictionary{
+				"type":  "s",
+				"stats": packstream.Dictionary{"system-updates": int64(1), "contains-system-updates": true},
+			},
+			want: ResultSummary{
+				QueryType:            QueryTypeSchemaWrite,
+				Counters:             Counters{SystemUpdates: 1, ContainsSystemUpdates: true},
+				ResultAvailableAfter: 12 * time.Millisecond,
+			},
+		},
+		{
+			name: "plan",
+			end: packstream.Dictionary{
+				"type": "r",
+				"plan": packstream.Dictionary{
+					"operatorType": "ProduceResults@neo4j",
+					"args":         packstream.Dictionary{"planner": "COST"},
+					"identifiers":  packstream.List{"n"},
+					"children": packstream.List{
+						packstream.Dictionary{
+							"operatorType": "AllNodesScan@neo4j",
+							"args":         packstream.Dictionary{"EstimatedRows": 10.0},
+							"identifiers":  packstream.List{"n"},
+						},
+					},
+				},
+			},
+			want: ResultSummary{
+				QueryType: QueryTypeRead,
+				Plan: &Plan{
+					Operator:    "ProduceResults@neo4j",
+					Arguments:   packstream.Dictionary{"planner": "COST"},
+					Identifiers: []string{"n"},
+					Children: []Plan{{
+						Operator:    "AllNodesScan@neo4j",
+						Arguments:   packstream.Dictionary{"EstimatedRows": 10.0},
+						Identifiers: []string{"n"},
+					}},
+				},
+				ResultAvailableAfter: 12 * time.Millisecond,
+			},
+		},
+		{
+			name: "profile",
+			end: packstream.Dictionary{
+				"type": "r",
+				"profile": packstream.Dictionary{
+					"operatorType":      "ProduceResults@neo4j",
+					"identifiers":       packstream.List{"n"},
+					"dbHits":            int64(0),
+					"rows":              int64(10),
+					"pageCacheHits":     int64(5),
+					"pageCacheMisses":   int64(1),
+					"pageCacheHitRatio": 5.0 / 6,
+					"time":              int64(1500),
+					"children": packstream.List{
+						packstream.Dictionary{
+							"operatorType": "AllNodesScan@neo4j",
+							"identifiers":  packstream.List{"n"},
+							"dbHits":       int64(11),
+							"rows":         int64(10),
+						},
+					},
+				},
+			},
+			want: ResultSummary{
+				QueryType: QueryTypeRead,
+				Profile: &ProfiledPlan{
+					Operator:          "ProduceResults@neo4j",
+					Identifiers:       []string{"n"},
+					Records:           10,
+					PageCacheHits:     5,
+					PageCacheMisses:   1,
+					PageCacheHitRatio: 5.0 / 6,
+					Time:              1500 * time.Nanosecond,
+					Children: []ProfiledPlan{{
+						Operator:    "AllNodesScan@neo4j",
+						Identifiers: []string{"n"},
+						DbHits:      11,
+						Records:     10,
+					}},
+				},
+				ResultAvailableAfter: 12 * time.Millisecond,
+			},
+		},
+		{
+			name: "notifications",
+			end: packstream.Dictionary{
+				"type": "r",
+				"notifications": packstream.List{
+					packstream.Dictionary{
+						"code":        "Neo.ClientNotification.Statement.CartesianProduct",
+						"title":       "This query builds a cartesian product",
+						"description": "If a part of a query contains multiple disconnected patterns...",
+						"severity":    "INFORMATION",
+						"category":    "PERFORMANCE",
+						"position":    packstream.Dictionary{"offset": int64(6), "line": int64(1), "column": int64(7)},
+					},
+					packstream.Dictionary{
+						"code":     "Neo.ClientNotification.Statement.FeatureDeprecationWarning",
+						"severity": "WARNING",
+					},
+				},
+			},
+			want: ResultSummary{
+				QueryType: QueryTypeRead,
+				Notifications: []Notification{
+					{
+						Code:        "Neo.ClientNotification.Statement.CartesianProduct",
+						Title:       "This query builds a cartesian product",
+						Description: "If a part of a query contains multiple disconnected patterns...",
+						Severity:    SeverityInformation,
+						Category:    CategoryPerformance,
+						Position:    &InputPosition{Offset: 6, Line: 1, Column: 7},
+					},
+					{
+						Code:     "Neo.ClientNotification.Statement.FeatureDeprecationWarning",
+						Severity: SeverityWarning,
+					},
+				},
+				ResultAvailableAfter: 12 * time.Millisecond,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseSummary(run, tt.end)
+
+			if got.Metadata["fields"] == nil || got.Metadata["type"] != tt.end["type"] {
+				t.Errorf("parseSummary() Metadata = %v, want the metadata of RUN and the end", got.Metadata)
+			}
+			got.Metadata = nil
+
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("parseSummary() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
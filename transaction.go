@@ -0,0 +1,133 @@
+package graphdb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mattmeyers/graphdb/bolt"
+)
+
+// UnknownCommitError is returned by Commit when the connection failed while
+// committing, so it is unknown whether the transaction was committed.
+type UnknownCommitError struct {
+	Err error
+}
+
+func (e *UnknownCommitError) Error() string {
+	return fmt.Sprintf("graphdb: commit outcome unknown: %v", e.Err)
+}
+
+func (e *UnknownCommitError) Unwrap() error {
+	return e.Err
+}
+
+// Tx is an explicit transaction. Its queries are committed or rolled back
+// together. A Tx is not safe for concurrent use.
+type Tx struct {
+	session *Session
+	conn    *bolt.Conn
+	result  *Result
+	closed  bool
+
+	// err is the last error of the transaction's queries.
+	err error
+
+	// bookmarks are the bookmarks the transaction began with.
+	bookmarks []string
+}
+
+// Run runs a query in the transaction. Remaining records of the previous
+// result are buffered so it can still be read.
+func (tx *Tx) Run(ctx context.Context, query string, params map[string]interface{}) (*Result, error) {
+	if tx.closed {
+		return nil, ErrTxClosed
+	}
+
+	if err := tx.buffer(ctx); err != nil {
+		return nil, err
+	}
+
+	res, err := runQuery(ctx, tx.conn, query, params, nil, int64(tx.session.config.FetchSize))
+	if err != nil {
+		tx.err = err
+		return nil, err
+	}
+	res.onDone = tx.observe
+	tx.result = res
+
+	return res, nil
+}
+
+// Commit commits the transaction. Records of open results are buffered
+// first.
+func (tx *Tx) Commit(ctx context.Context) error {
+	if tx.closed {
+		return ErrTxClosed
+	}
+	defer tx.close(ctx)
+
+	if err := tx.buffer(ctx); err != nil {
+		return err
+	}
+
+	meta, err := tx.conn.Commit(ctx)
+	if err != nil {
+		tx.err = err
+		// The outcome is unknown if the connection failed or the commit
+		// was cancelled after it was sent.
+		if s := tx.conn.State(); s == bolt.Defunct || s == bolt.Interrupted {
+			return &UnknownCommitError{Err: err}
+		}
+		return err
+	}
+
+	return tx.session.updateBookmark(ctx, tx.bookmarks, meta["bookmark"])
+}
+
+// Rollback rolls back the transaction. Rolling back a closed transaction
+// is a no-op, so Rollback can be deferred right after BeginTransaction.
+func (tx *Tx) Rollback(ctx context.Context) error {
+	if tx.closed {
+		return nil
+	}
+	defer tx.close(ctx)
+
+	if tx.result != nil {
+		tx.result.Consume(ctx)
+	}
+
+	switch tx.conn.State() {
+	case bolt.TxReady:
+		return tx.conn.Rollback(ctx)
+	case bolt.Failed:
+		// The server has already rolled back the transaction.
+		return tx.conn.Reset(ctx)
+	}
+
+	return nil
+}
+
+// buffer buffers the records of the open result, if any.
+func (tx *Tx) buffer(ctx context.Context) error {
+	if tx.result == nil {
+		return nil
+	}
+
+	err := tx.result.buffer(ctx)
+	tx.result = nil
+
+	return err
+}
+
+// observe records the error ending a result of the transaction.
+func (tx *Tx) observe(ctx context.Context, err error) {
+	if err != nil {
+		tx.err = err
+	}
+}
+
+func (tx *Tx) close(ctx context.Context) {
+	tx.closed = true
+	tx.session.tx = nil
+	tx.session.release(ctx, tx.err)
+}